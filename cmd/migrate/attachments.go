@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+const (
+	attachmentLinksWikilink = "wikilink"
+	attachmentLinksMarkdown = "markdown"
+	// attachmentLinksStatic links to the files from the root of the site
+	// they are served from, e.g. the static folder of Hugo
+	attachmentLinksStatic = "static"
+
+	// attachmentTimeout bounds the download of a single attachment, so a
+	// stalled connection does not hang the migration
+	attachmentTimeout = 5 * time.Minute
+)
+
+// attachments downloads the files hosted by Notion into the vault. Their URLs
+// are signed and expire after an hour, so linking to them would break the notes.
+// Files are named after their content hash, so the same file is stored once.
+type attachments struct {
+	vault string
+	dir   string
+	links string
+
+	client     *http.Client
+	downloaded map[string]string
+	// downloading holds a lock per file, so pages sharing a file wait for a
+	// single download instead of fetching it at the same time
+	downloading map[string]*sync.Mutex
+	mu          sync.Mutex
+}
+
+var attachmentStore *attachments
+
+func newAttachments(vault, dir, links string) (*attachments, error) {
+	if links != attachmentLinksWikilink && links != attachmentLinksMarkdown && links != attachmentLinksStatic {
+		return nil, fmt.Errorf("unsupported attachment links %q. use %s, %s or %s", links, attachmentLinksWikilink, attachmentLinksMarkdown, attachmentLinksStatic)
+	}
+
+	return &attachments{
+		vault:       vault,
+		dir:         dir,
+		links:       links,
+		client:      &http.Client{Timeout: attachmentTimeout},
+		downloaded:  map[string]string{},
+		downloading: map[string]*sync.Mutex{},
+	}, nil
+}
+
+// save downloads the file and returns its path within the vault.
+func (a *attachments) save(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid attachment URL %s. error: %w", fileURL, err)
+	}
+
+	// The query string holds the signature, which changes every time the page
+	// is fetched, so we leave it out of the key.
+	key := u.Scheme + "://" + u.Host + u.Path
+
+	a.mu.Lock()
+	lock, ok := a.downloading[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		a.downloading[key] = lock
+	}
+	a.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	a.mu.Lock()
+	name, ok := a.downloaded[key]
+	a.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	dir := filepath.Join(a.vault, a.dir)
+	if err = os.MkdirAll(dir, 0770); err != nil {
+		return "", fmt.Errorf("failed to create the attachments directory. error: %w", err)
+	}
+
+	response, err := a.client.Get(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download attachment %s. error: %w", u.Path, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download attachment %s. status: %d", u.Path, response.StatusCode)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create attachment file. error: %w", err)
+	}
+	// Nothing is left behind when the download fails or the same content was
+	// saved before
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, hash), response.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download attachment %s. error: %w", u.Path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+
+	fileName := hex.EncodeToString(hash.Sum(nil))[:16] + strings.ToLower(path.Ext(u.Path))
+	name = path.Join(filepath.ToSlash(a.dir), fileName)
+	target := filepath.Join(dir, fileName)
+
+	if _, err = os.Stat(target); os.IsNotExist(err) {
+		if err = os.Rename(tmp.Name(), target); err != nil {
+			return "", fmt.Errorf("failed to save attachment %s. error: %w", fileName, err)
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("failed to save attachment %s. error: %w", fileName, err)
+	}
+
+	a.mu.Lock()
+	a.downloaded[key] = name
+	a.mu.Unlock()
+
+	return name, nil
+}
+
+// link returns the markdown linking the note at notePath to the attachment.
+func (a *attachments) link(notePath, name, title string, embed bool) string {
+	var link string
+
+	switch a.links {
+	case attachmentLinksWikilink:
+		link = "[[" + path.Base(name) + "]]"
+	case attachmentLinksStatic:
+		link = fmt.Sprintf("[%s](%s)", linkText(title), linkDestination("/"+name))
+	default:
+		link = fmt.Sprintf("[%s](%s)", linkText(title), linkDestination(a.relative(notePath, name)))
+	}
+
+	if embed {
+		return "!" + link
+	}
+	return link
+}
+
+// relative returns the path to the attachment from the note at notePath.
+func (a *attachments) relative(notePath, name string) string {
+	target := filepath.Join(a.vault, filepath.FromSlash(name))
+	relative, err := filepath.Rel(filepath.Dir(notePath), target)
+	if err != nil {
+		relative = target
+	}
+	return filepath.ToSlash(relative)
+}
+
+// fileLink returns the markdown for a file object, downloading it into the
+// vault when it is hosted by Notion.
+func fileLink(notePath string, fileType notion.FileType, file *notion.FileFile, external *notion.FileExternal, title string, embed bool) (string, error) {
+	var fileURL string
+
+	switch fileType {
+	case notion.FileTypeExternal:
+		fileURL = external.URL
+	case notion.FileTypeFile:
+		fileURL = file.URL
+		if attachmentStore != nil {
+			name, err := attachmentStore.save(fileURL)
+			if err != nil {
+				return "", err
+			}
+			if title == "" && !embed {
+				title = path.Base(name)
+			}
+			return attachmentStore.link(notePath, name, title, embed), nil
+		}
+	default:
+		return "", nil
+	}
+
+	// Links to files need some text to be clickable
+	if title == "" && !embed {
+		if u, err := url.Parse(fileURL); err == nil {
+			title = path.Base(u.Path)
+		}
+	}
+
+	link := fmt.Sprintf("[%s](%s)", linkText(title), fileURL)
+	if embed {
+		return "!" + link, nil
+	}
+	return link, nil
+}
+
+// linkText escapes the text of a link to a file, kept on a single line so
+// file names with brackets or line breaks do not end the link.
+func linkText(title string) string {
+	return escapeMarkdown(strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(title), false)
+}
+
+// linkDestination wraps destinations with spaces or parentheses in angle
+// brackets, which markdown links can not hold otherwise.
+func linkDestination(destination string) string {
+	if strings.ContainsAny(destination, " ()") {
+		return "<" + destination + ">"
+	}
+	return destination
+}
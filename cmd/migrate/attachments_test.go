@@ -0,0 +1,276 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// fileServer serves files by path and counts the requests for each of them.
+type fileServer struct {
+	files    map[string]string
+	requests map[string]int
+	mu       sync.Mutex
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	content, ok := s.files[r.URL.Path]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(content))
+}
+
+func (s *fileServer) requestsFor(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func TestAttachments_Save(t *testing.T) {
+	files := &fileServer{
+		files: map[string]string{
+			"/space/diagram.png": "image",
+			"/space/copy.PNG":    "image",
+			"/space/notes.pdf":   "document",
+		},
+		requests: map[string]int{},
+	}
+	server := httptest.NewServer(files)
+	defer server.Close()
+
+	vault := t.TempDir()
+	store, err := newAttachments(vault, "attachments", attachmentLinksWikilink)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	diagram, err := store.save(server.URL + "/space/diagram.png?X-Amz-Signature=first")
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	if !strings.HasPrefix(diagram, "attachments/") || filepath.Ext(diagram) != ".png" {
+		t.Errorf("incorrect name expected attachments/<hash>.png got: %s", diagram)
+	}
+
+	content, err := os.ReadFile(filepath.Join(vault, filepath.FromSlash(diagram)))
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if string(content) != "image" {
+		t.Errorf("incorrect content expected image got: %s", content)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+		requests int
+	}{
+		{"signature changed", "/space/diagram.png?X-Amz-Signature=second", diagram, 1},
+		{"same content with another name", "/space/copy.PNG", diagram, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, err := store.save(server.URL + test.url)
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if name != test.expected {
+				t.Errorf("incorrect name expected %s got: %s", test.expected, name)
+			}
+			path := strings.Split(test.url, "?")[0]
+			if requests := files.requestsFor(path); requests != test.requests {
+				t.Errorf("incorrect requests for %s expected %d got: %d", path, test.requests, requests)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(filepath.Join(vault, "attachments"))
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("incorrect attachments expected a single file got: %d", len(entries))
+	}
+
+	// Pages sharing a file download it once
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.save(server.URL + "/space/notes.pdf"); err != nil {
+				t.Errorf("expected nil got: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if requests := files.requestsFor("/space/notes.pdf"); requests != 1 {
+		t.Errorf("incorrect requests for /space/notes.pdf expected 1 got: %d", requests)
+	}
+}
+
+func TestAttachments_SaveFailures(t *testing.T) {
+	files := &fileServer{files: map[string]string{}, requests: map[string]int{}}
+	server := httptest.NewServer(files)
+	defer server.Close()
+
+	stalled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(stalled)
+
+	closed := httptest.NewServer(files)
+	closed.Close()
+
+	vault := t.TempDir()
+	store, err := newAttachments(vault, "attachments", attachmentLinksMarkdown)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	store.client.Timeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"not found", server.URL + "/space/missing.png", "status: 404"},
+		{"connection refused", closed.URL + "/space/image.png", "failed to download attachment /space/image.png"},
+		{"timeout", slow.URL + "/space/image.png", "failed to download attachment /space/image.png"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := store.save(test.url)
+			if err == nil {
+				t.Fatalf("expected an error got: nil")
+			}
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("incorrect error expected to contain %q got: %v", test.expected, err)
+			}
+		})
+	}
+
+	// Failed downloads are not remembered, so they are retried
+	files.files["/space/missing.png"] = "image"
+	if _, err = store.save(server.URL + "/space/missing.png"); err != nil {
+		t.Errorf("expected nil got: %v", err)
+	}
+
+	// Nothing is left behind from the failed downloads
+	entries, err := os.ReadDir(filepath.Join(vault, "attachments"))
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("incorrect attachments expected a single file got: %d", len(entries))
+	}
+}
+
+func TestAttachments_Link(t *testing.T) {
+	vault := filepath.Join("tmp", "vault")
+
+	tests := []struct {
+		name     string
+		links    string
+		notePath string
+		title    string
+		embed    bool
+		expected string
+	}{
+		{"wikilink embed", attachmentLinksWikilink, filepath.Join(vault, "Page.md"), "", true, "![[0123abcd.png]]"},
+		{"wikilink", attachmentLinksWikilink, filepath.Join(vault, "Notes", "Page.md"), "Diagram", false, "[[0123abcd.png]]"},
+		{"markdown at the root", attachmentLinksMarkdown, filepath.Join(vault, "Page.md"), "Diagram", false, "[Diagram](attachments/0123abcd.png)"},
+		{"markdown nested", attachmentLinksMarkdown, filepath.Join(vault, "Notes", "Sub", "Page.md"), "", true, "![](../../attachments/0123abcd.png)"},
+		{"static", attachmentLinksStatic, filepath.Join(vault, "posts", "Page.md"), "", true, "![](/attachments/0123abcd.png)"},
+		{"markdown title with brackets", attachmentLinksMarkdown, filepath.Join(vault, "Page.md"), "Plan [v2]\nfinal", false, "[Plan \\[v2\\] final](attachments/0123abcd.png)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, err := newAttachments(vault, "attachments", test.links)
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if link := store.link(test.notePath, "attachments/0123abcd.png", test.title, test.embed); link != test.expected {
+				t.Errorf("incorrect link expected %s got: %s", test.expected, link)
+			}
+		})
+	}
+
+	store, err := newAttachments(vault, "My Files", attachmentLinksMarkdown)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	expected := "[Diagram](<My Files/0123abcd.png>)"
+	if link := store.link(filepath.Join(vault, "Page.md"), "My Files/0123abcd.png", "Diagram", false); link != expected {
+		t.Errorf("incorrect link expected %s got: %s", expected, link)
+	}
+
+	if _, err = newAttachments(vault, "attachments", "html"); err == nil {
+		t.Errorf("expected an error for unsupported links got: nil")
+	}
+}
+
+func TestFileLink_Attachments(t *testing.T) {
+	files := &fileServer{files: map[string]string{"/space/report.pdf": "report"}, requests: map[string]int{}}
+	server := httptest.NewServer(files)
+	defer server.Close()
+
+	store := attachmentStore
+	defer func() { attachmentStore = store }()
+
+	vault := t.TempDir()
+	var err error
+	if attachmentStore, err = newAttachments(vault, "attachments", attachmentLinksMarkdown); err != nil {
+		t.Fatal(err)
+	}
+
+	notePath := filepath.Join(vault, "Page.md")
+
+	link, err := fileLink(notePath, notion.FileTypeFile, &notion.FileFile{URL: server.URL + "/space/report.pdf"}, nil, "", false)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if !strings.HasPrefix(link, "[") || !strings.Contains(link, "](attachments/") || !strings.HasSuffix(link, ".pdf)") {
+		t.Errorf("incorrect link expected a markdown link to the attachment got: %s", link)
+	}
+
+	// External files are linked as they are
+	link, err = fileLink(notePath, notion.FileTypeExternal, nil, &notion.FileExternal{URL: server.URL + "/space/report.pdf"}, "Report [final]", false)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if expected := "[Report \\[final\\]](" + server.URL + "/space/report.pdf)"; link != expected {
+		t.Errorf("incorrect link expected %s got: %s", expected, link)
+	}
+	if requests := files.requestsFor("/space/report.pdf"); requests != 1 {
+		t.Errorf("incorrect requests expected 1 got: %d", requests)
+	}
+
+	if _, err = fileLink(notePath, notion.FileTypeFile, &notion.FileFile{URL: server.URL + "/space/missing.pdf"}, nil, "", false); err == nil {
+		t.Errorf("expected an error for a failed download got: nil")
+	}
+}
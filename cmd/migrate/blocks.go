@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+// tocMarker is written where a table of contents block was found. It is
+// replaced once the whole page is rendered and all its headings are known.
+const tocMarker = "%% notion-table-of-contents %%"
+
+var headingRegex = regexp.MustCompile(`^\t*(#{1,3}) (.+)$`)
+
+// writeSyncedBlock writes the content of a synced block. The original block
+// holds the content as its children, duplicates point to the original.
+func writeSyncedBlock(client client.NotionClient, block *notion.SyncedBlock, node *blockNode, buffer *bufio.Writer, notePath string, depth int) error {
+	if node.unavailable {
+		writePlaceholder(buffer, indentation(depth), fmt.Sprintf("Synced block %s is not accessible", block.SyncedFrom.BlockID))
+		return nil
+	}
+
+	return writeChrildren(client, node, buffer, notePath, depth)
+}
+
+// writeBreadcrumb writes the links to the ancestors of the page holding the
+// block, from the top most one.
+func writeBreadcrumb(client client.NotionClient, block notion.Block, buffer *bufio.Writer, prefix string) error {
+	parent := block.Parent()
+	if parent.Type != notion.ParentTypePage {
+		writePlaceholder(buffer, prefix, "Breadcrumb")
+		return nil
+	}
+
+	links := []string{}
+	id := parent.PageID
+	parentType := parent.Type
+
+	// Pages and databases are walked up until the workspace is reached.
+	// Block parents can not be fetched, so the breadcrumb stops there.
+	for id != "" {
+		var title string
+		switch parentType {
+		case notion.ParentTypePage:
+			page, err := client.FindPageByID(context.Background(), id)
+			if err != nil {
+				return fmt.Errorf("failed to find breadcrumb page %s. error: %w", id, err)
+			}
+			title = pageTitle(page)
+			parent = page.Parent
+		case notion.ParentTypeDatabase:
+			db, err := client.FindDatabaseByID(context.Background(), id)
+			if err != nil {
+				return fmt.Errorf("failed to find breadcrumb database %s. error: %w", id, err)
+			}
+			title = extractPlainTextFromRichText(db.Title)
+			parent = db.Parent
+		}
+
+		if title != "" {
+			links = append([]string{output.reference(title)}, links...)
+		}
+
+		parentType = parent.Type
+		switch parent.Type {
+		case notion.ParentTypePage:
+			id = parent.PageID
+		case notion.ParentTypeDatabase:
+			id = parent.DatabaseID
+		default:
+			id = ""
+		}
+	}
+
+	buffer.WriteString(prefix)
+	buffer.WriteString(strings.Join(links, " / "))
+	buffer.WriteString("\n")
+
+	return nil
+}
+
+// writePlaceholder leaves a notice in the note for content that could not be
+// migrated, so it can be found and fixed by hand.
+func writePlaceholder(buffer *bufio.Writer, prefix, text string) {
+	buffer.WriteString(prefix)
+	buffer.WriteString(output.placeholder(text))
+	buffer.WriteString("\n")
+}
+
+// blockType returns the name of the Notion block type for placeholders.
+func blockType(block notion.Block) string {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", block), "*notion.")
+	return strings.TrimSuffix(name, "Block")
+}
+
+// pageTitle returns the title of the page, whatever the name of its title
+// property is.
+func pageTitle(page notion.Page) string {
+	switch props := page.Properties.(type) {
+	case notion.DatabasePageProperties:
+		for _, val := range props {
+			if val.Type == notion.DBPropTypeTitle {
+				return extractPlainTextFromRichText(val.Title)
+			}
+		}
+	case notion.PageProperties:
+		return extractPlainTextFromRichText(props.Title.Title)
+	}
+
+	return ""
+}
+
+// insertTableOfContents replaces the table of contents markers with an
+// outline of the headings of the note linking to each of them.
+func insertTableOfContents(content string) string {
+	if !strings.Contains(content, tocMarker) {
+		return content
+	}
+
+	lines := strings.Split(content, "\n")
+
+	type heading struct {
+		level int
+		text  string
+	}
+	headings := []heading{}
+	minLevel := 0
+	inCode := false
+
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimLeft(line, "\t"), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+
+		match := headingRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		level := len(match[1])
+		if minLevel == 0 || level < minLevel {
+			minLevel = level
+		}
+		headings = append(headings, heading{level: level, text: match[2]})
+	}
+
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.TrimLeft(line, "\t") != tocMarker {
+			result = append(result, line)
+			continue
+		}
+
+		prefix := strings.TrimSuffix(line, tocMarker)
+		for _, h := range headings {
+			if link := output.headingLink(h.text); link != "" {
+				result = append(result, fmt.Sprintf("%s%s- %s", prefix, indentation(h.level-minLevel), link))
+			}
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+const (
+	modeDatabase  = "database"
+	modePage      = "page"
+	modeWorkspace = "workspace"
+)
+
+// discoverPageTree returns the page and all the pages below it, as sub pages
+// and, with -child-databases, as pages of the databases within it.
+func discoverPageTree(client client.NotionClient, rootID string, state *syncState) ([]notion.Page, error) {
+	root, err := client.FindPageByID(context.Background(), rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find page %s. error: %w", rootID, err)
+	}
+
+	return discoverPages(client, []notion.Page{root}, state)
+}
+
+// discovery finds the pages below the roots on the workers, each job looking
+// into a page and adding a job for every page found in it.
+type discovery struct {
+	client client.NotionClient
+	state  *syncState
+	queue  *queue
+	seen   map[string]bool
+	// found holds the pages found in each page, in the order of its blocks
+	found map[string][]notion.Page
+	mu    sync.Mutex
+}
+
+// discoverPages returns the pages along all the pages below them. The block
+// trees fetched to find the sub pages are kept for the render pass.
+func discoverPages(client client.NotionClient, roots []notion.Page, state *syncState) ([]notion.Page, error) {
+	d := &discovery{
+		client: client,
+		state:  state,
+		queue:  newQueue("discovering notion pages"),
+		seen:   map[string]bool{},
+		found:  map[string][]notion.Page{},
+	}
+
+	d.add(roots)
+	if errorJobs := runWorkers(d.queue, nil, *concurrency); len(errorJobs) > 0 {
+		return nil, errorJobs[0].err
+	}
+
+	// The pages are listed breadth first from the roots, so they are given
+	// their paths in the same order on every run
+	pages := []notion.Page{}
+	seen := map[string]bool{}
+	pending := append([]notion.Page{}, roots...)
+
+	for len(pending) > 0 {
+		page := pending[0]
+		pending = pending[1:]
+
+		if seen[page.ID] {
+			continue
+		}
+		seen[page.ID] = true
+		pages = append(pages, page)
+		pending = append(pending, d.found[page.ID]...)
+	}
+
+	return pages, nil
+}
+
+// add queues a job for each page that was not found before.
+func (d *discovery) add(pages []notion.Page) {
+	jobs := []job{}
+
+	d.mu.Lock()
+	for _, page := range pages {
+		if d.seen[page.ID] {
+			continue
+		}
+		d.seen[page.ID] = true
+
+		page := page
+		jobs = append(jobs, job{
+			id:         page.ID,
+			lastEdited: page.LastEditedTime,
+			run:        func() error { return d.discover(page) },
+		})
+	}
+	d.mu.Unlock()
+
+	d.queue.addJobs(jobs)
+}
+
+// discover queues the sub pages of the page and, with -child-databases, the
+// pages of the databases within it.
+func (d *discovery) discover(page notion.Page) error {
+	children, err := d.children(page)
+	if err != nil {
+		return err
+	}
+
+	found := []notion.Page{}
+
+	for _, id := range children.Pages {
+		subPage, err := d.client.FindPageByID(context.Background(), id)
+		if err != nil {
+			return fmt.Errorf("failed to find sub page %s. error: %w", id, err)
+		}
+		found = append(found, subPage)
+	}
+
+	// The pages of inline databases are only migrated when asked for
+	if *childDatabases {
+		for _, id := range children.Databases {
+			dbPages, err := fetchNotionDBPages(d.client, id, nil)
+			if err != nil {
+				return err
+			}
+			found = append(found, dbPages...)
+		}
+	}
+
+	d.mu.Lock()
+	d.found[page.ID] = found
+	d.mu.Unlock()
+
+	d.add(found)
+
+	return nil
+}
+
+// children returns the sub pages and databases of the page. The pages that did
+// not change since the last run are not fetched, they keep the children found
+// then.
+func (d *discovery) children(page notion.Page) (pageChildren, error) {
+	if !*fullSync {
+		if children, ok := d.state.knownChildren(page.ID, page.LastEditedTime); ok {
+			return children, nil
+		}
+	}
+
+	subPages, databases, err := findSubPages(d.client, page.ID)
+	if err != nil {
+		return pageChildren{}, err
+	}
+
+	children := pageChildren{Pages: subPages, Databases: databases}
+	d.state.setChildren(page.ID, children)
+
+	return children, nil
+}
+
+// findSubPages returns the IDs of the sub pages and databases found in the
+// blocks of the page, including the ones nested in toggles or columns.
+func findSubPages(client client.NotionClient, pageID string) ([]string, []string, error) {
+	nodes, err := fetchBlockTree(client, pageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	blockTrees.set(pageID, nodes)
+
+	pages := []string{}
+	databases := []string{}
+
+	var walk func(nodes []*blockNode)
+	walk = func(nodes []*blockNode) {
+		for _, node := range nodes {
+			switch b := node.block.(type) {
+			case *notion.ChildPageBlock:
+				pages = append(pages, b.ID())
+			case *notion.ChildDatabaseBlock:
+				databases = append(databases, b.ID())
+			case *notion.SyncedBlock:
+				// The content of duplicates belongs to the page of the original
+				if b.SyncedFrom == nil {
+					walk(node.children)
+				}
+			default:
+				walk(node.children)
+			}
+		}
+	}
+	walk(nodes)
+
+	return pages, databases, nil
+}
+
+// discoverWorkspace returns every page shared with the integration.
+func discoverWorkspace(client client.NotionClient) ([]notion.Page, error) {
+	opts := &notion.SearchOpts{
+		Filter: &notion.SearchFilter{Property: "object", Value: "page"},
+	}
+
+	pages := []notion.Page{}
+
+	for {
+		response, err := client.Search(context.Background(), opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search the workspace. error: %w", err)
+		}
+
+		for _, result := range response.Results {
+			if page, ok := result.(notion.Page); ok && !page.Archived {
+				pages = append(pages, page)
+			}
+		}
+
+		if !response.HasMore || response.NextCursor == nil {
+			return pages, nil
+		}
+
+		opts.StartCursor = *response.NextCursor
+	}
+}
+
+// assignPaths gives every discovered page its path and records its title
+// before any of them is rendered, so links between them resolve in a single
+// pass without fetching the pages they point to.
+func assignPaths(client client.NotionClient, pages []notion.Page, rootID string) (map[string]string, error) {
+	paths := map[string]string{}
+	hasSubPages := map[string]bool{}
+
+	for _, page := range pages {
+		if page.Parent.Type == notion.ParentTypePage {
+			hasSubPages[page.Parent.PageID] = true
+		}
+	}
+
+	for _, page := range pages {
+		var path string
+		var err error
+
+		// The root of the page tree goes at the top of the vault, whatever
+		// its ancestors are
+		if page.ID == rootID && hierarchy != nil {
+			path, err = pagePaths.assign(page.ID, filepath.Join(*obsidianVault, sanitizeFileName(pageTitle(page))+noteExtension))
+		} else {
+			path, err = discoveredPath(client, page)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if hierarchy != nil && hierarchy.folderNotes && hasSubPages[page.ID] {
+			path = folderNotePath(path)
+			pagePaths.move(page.ID, path)
+		}
+
+		pagePaths.setTitle(page.ID, pageTitle(page))
+		paths[page.ID] = path
+	}
+
+	return paths, nil
+}
+
+// discoveredPath returns the path of a page, unless it was already given one.
+// Pages of other databases go into a folder named after their database.
+func discoveredPath(client client.NotionClient, page notion.Page) (string, error) {
+	if path, ok := pagePaths.pathOf(page.ID); ok {
+		return path, nil
+	}
+
+	if hierarchy != nil {
+		return hierarchy.pagePath(client, page)
+	}
+
+	folder := *obsidianVault
+	// Since we are migrating from the same DB we do need to create a subfolder
+	// within the Obsidian vault. So we can skip fetching the database to gather
+	// the name to create the subfolder
+	if page.Parent.Type == notion.ParentTypeDatabase && page.Parent.DatabaseID != *databaseID {
+		db, err := client.FindDatabaseByID(context.Background(), page.Parent.DatabaseID)
+		if err != nil {
+			return "", fmt.Errorf("failed to find parent db %s.  error: %w", page.Parent.DatabaseID, err)
+		}
+
+		folder = filepath.Join(folder, sanitizeFileName(extractPlainTextFromRichText(db.Title)))
+	}
+
+	return pagePaths.assign(page.ID, filepath.Join(folder, sanitizeFileName(pageTitle(page))+noteExtension))
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func TestDiscoverPageTree(t *testing.T) {
+	vault, paths, tree, id, databases, trees := *obsidianVault, pagePaths, hierarchy, *databaseID, *childDatabases, blockTrees
+	*obsidianVault = "vault"
+	*databaseID = "root"
+	*childDatabases = true
+	blockTrees = &treeCache{trees: map[string][]*blockNode{}}
+	defer func() {
+		*obsidianVault, pagePaths, hierarchy, *databaseID, *childDatabases, blockTrees = vault, paths, tree, id, databases, trees
+	}()
+
+	var err error
+	if pagePaths, err = newNotePaths("vault", collisionSuffix, nil); err != nil {
+		t.Fatal(err)
+	}
+	hierarchy = &pageTree{folderNotes: true}
+
+	entry := notion.Page{
+		ID:         "entry",
+		Parent:     notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: "tasks"},
+		Properties: notion.DatabasePageProperties{"Task": {Type: notion.DBPropTypeTitle, Title: []notion.RichText{{PlainText: "Entry"}}}},
+	}
+
+	fake := &client.Fake{
+		Pages: map[string]notion.Page{
+			// The parent of the root is not shared with the integration
+			"root":   titledPage("root", notion.Parent{Type: notion.ParentTypePage, PageID: "private"}, "Wiki"),
+			"child":  titledPage("child", notion.Parent{Type: notion.ParentTypePage, PageID: "root"}, "Guides"),
+			"nested": titledPage("nested", notion.Parent{Type: notion.ParentTypeBlock, BlockID: "toggle"}, "Setup"),
+			"entry":  entry,
+		},
+		Databases: map[string]notion.Database{
+			"tasks": {ID: "tasks", Title: []notion.RichText{{PlainText: "Tasks"}}, Parent: notion.Parent{Type: notion.ParentTypePage, PageID: "root"}},
+		},
+		DatabasePages: map[string][]notion.Page{
+			"tasks": {entry},
+		},
+		Blocks: map[string][]notion.Block{
+			"root": blocksFromJSON(t, `[
+				{"object":"block","id":"child","type":"child_page","parent":{"type":"page_id","page_id":"root"},"child_page":{"title":"Guides"}},
+				{"object":"block","id":"tasks","type":"child_database","parent":{"type":"page_id","page_id":"root"},"child_database":{"title":"Tasks"}}
+			]`),
+			"child":  blocksFromJSON(t, `[{"object":"block","id":"toggle","type":"toggle","has_children":true,"parent":{"type":"page_id","page_id":"child"},"toggle":{"rich_text":[]}}]`),
+			"toggle": blocksFromJSON(t, `[{"object":"block","id":"nested","type":"child_page","parent":{"type":"block_id","block_id":"toggle"},"child_page":{"title":"Setup"}}]`),
+		},
+	}
+
+	state, err := loadSyncState(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := discoverPageTree(fake, "root", state)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	ids := []string{}
+	for _, page := range pages {
+		ids = append(ids, page.ID)
+	}
+	sort.Strings(ids)
+	if len(ids) != 4 || ids[0] != "child" || ids[1] != "entry" || ids[2] != "nested" || ids[3] != "root" {
+		t.Fatalf("incorrect pages expected [child entry nested root] got: %v", ids)
+	}
+
+	notePaths, err := assignPaths(fake, pages, "root")
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	tests := []struct {
+		pageID   string
+		expected string
+	}{
+		{"root", "vault/Wiki/Wiki.md"},
+		{"child", "vault/Wiki/Guides.md"},
+		{"nested", "vault/Wiki/Guides/Setup.md"},
+		{"entry", "vault/Wiki/Tasks/Entry.md"},
+	}
+
+	for _, test := range tests {
+		if path := notePaths[test.pageID]; path != filepath.FromSlash(test.expected) {
+			t.Errorf("incorrect path for %s expected %q got: %q", test.pageID, test.expected, path)
+		}
+	}
+
+	// Links to discovered pages resolve before any of them is rendered
+	if link, err := pageLink(fake, "vault/Wiki/Wiki.md", "nested", ""); err != nil || link != "[[Setup]]" {
+		t.Errorf("incorrect link expected [[Setup]] got: %q", link)
+	}
+}
+
+func TestDiscoverPages_ReusesBlockTrees(t *testing.T) {
+	vault, paths, id, databases, trees := *obsidianVault, pagePaths, *databaseID, *childDatabases, blockTrees
+	*obsidianVault = t.TempDir()
+	*databaseID = "projects"
+	*childDatabases = false
+	blockTrees = &treeCache{trees: map[string][]*blockNode{}}
+	defer func() {
+		*obsidianVault, pagePaths, *databaseID, *childDatabases, blockTrees = vault, paths, id, databases, trees
+	}()
+
+	var err error
+	if pagePaths, err = newNotePaths(*obsidianVault, collisionSuffix, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	launch := notion.Page{
+		ID:         "launch",
+		Parent:     notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: "projects"},
+		Properties: notion.DatabasePageProperties{"Name": {Type: notion.DBPropTypeTitle, Title: []notion.RichText{{PlainText: "Launch"}}}},
+	}
+	entry := notion.Page{
+		ID:         "entry",
+		Parent:     notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: "tasks"},
+		Properties: notion.DatabasePageProperties{"Task": {Type: notion.DBPropTypeTitle, Title: []notion.RichText{{PlainText: "Entry"}}}},
+	}
+
+	fake := &client.Fake{
+		Pages: map[string]notion.Page{
+			"notes": titledPage("notes", notion.Parent{Type: notion.ParentTypePage, PageID: "launch"}, "Notes"),
+		},
+		DatabasePages: map[string][]notion.Page{
+			"tasks": {entry},
+		},
+		Blocks: map[string][]notion.Block{
+			"launch": blocksFromJSON(t, `[
+				{"object":"block","id":"toggle","type":"toggle","has_children":true,"toggle":{"rich_text":[]}},
+				{"object":"block","id":"tasks","type":"child_database","child_database":{"title":"Tasks"}}
+			]`),
+			"toggle": blocksFromJSON(t, `[{"object":"block","id":"notes","type":"child_page","child_page":{"title":"Notes"}}]`),
+			"notes":  blocksFromJSON(t, "["+blockJSON("text", "paragraph", "text", false)+"]"),
+		},
+	}
+
+	state, err := loadSyncState(*obsidianVault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := discoverPages(fake, []notion.Page{launch}, state)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	// The pages of the inline database are left out without -child-databases
+	if len(pages) != 2 || pages[0].ID != "launch" || pages[1].ID != "notes" {
+		t.Fatalf("incorrect pages expected [launch notes] got: %v", pages)
+	}
+
+	notePaths, err := assignPaths(fake, pages, *databaseID)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	requests := fake.BlockChildrenRequests
+	for _, page := range pages {
+		if err = fetchAndSaveToObsidianVault(fake, page, map[string]bool{}, map[string]bool{}, notePaths[page.ID], false); err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+	}
+
+	if fake.BlockChildrenRequests != requests {
+		t.Errorf("incorrect block children requests expected %d got: %d", requests, fake.BlockChildrenRequests)
+	}
+
+	// The next run finds the same pages without fetching the unchanged ones
+	for _, page := range pages {
+		if err = recordPage(state, page, notePaths[page.ID]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages, err = discoverPages(fake, []notion.Page{launch}, state)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if len(pages) != 2 || pages[0].ID != "launch" || pages[1].ID != "notes" {
+		t.Fatalf("incorrect pages expected [launch notes] got: %v", pages)
+	}
+	if fake.BlockChildrenRequests != requests {
+		t.Errorf("incorrect block children requests expected %d got: %d", requests, fake.BlockChildrenRequests)
+	}
+}
+
+func TestDiscoverWorkspace(t *testing.T) {
+	fake := &client.Fake{
+		Pages: map[string]notion.Page{
+			"a":        titledPage("a", notion.Parent{Type: notion.ParentTypeWorkspace}, "A"),
+			"b":        titledPage("b", notion.Parent{Type: notion.ParentTypePage, PageID: "a"}, "B"),
+			"archived": {ID: "archived", Archived: true},
+		},
+		Databases: map[string]notion.Database{
+			"db": {ID: "db"},
+		},
+	}
+
+	pages, err := discoverWorkspace(fake)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	ids := []string{}
+	for _, page := range pages {
+		ids = append(ids, page.ID)
+	}
+	sort.Strings(ids)
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("incorrect pages expected [a b] got: %v", ids)
+	}
+}
+
+// moreWithoutCursor answers the searches with more results but no cursor to
+// fetch them.
+type moreWithoutCursor struct {
+	*client.Fake
+}
+
+func (c moreWithoutCursor) Search(ctx context.Context, opts *notion.SearchOpts) (notion.SearchResponse, error) {
+	response, err := c.Fake.Search(ctx, opts)
+	response.HasMore = true
+	return response, err
+}
+
+func TestDiscoverWorkspace_NoCursor(t *testing.T) {
+	fake := &client.Fake{
+		Pages: map[string]notion.Page{
+			"a": titledPage("a", notion.Parent{Type: notion.ParentTypeWorkspace}, "A"),
+		},
+	}
+
+	pages, err := discoverWorkspace(moreWithoutCursor{fake})
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if len(pages) != 1 || pages[0].ID != "a" {
+		t.Errorf("incorrect pages expected [a] got: %v", pages)
+	}
+}
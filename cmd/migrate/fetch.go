@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+// fetchSlots bounds the children fetched at the same time within a page.
+// Without slots the children are fetched one after another.
+var fetchSlots chan struct{}
+
+// blockTrees keeps the block trees fetched by the discovery pass, so the
+// render pass does not fetch the same pages again.
+var blockTrees = &treeCache{trees: map[string][]*blockNode{}}
+
+type treeCache struct {
+	trees map[string][]*blockNode
+	mu    sync.Mutex
+}
+
+func (c *treeCache) set(pageID string, nodes []*blockNode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trees[pageID] = nodes
+}
+
+// take returns the tree of the page and forgets it, since each page is
+// rendered once.
+func (c *treeCache) take(pageID string) ([]*blockNode, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	nodes, ok := c.trees[pageID]
+	delete(c.trees, pageID)
+	return nodes, ok
+}
+
+// blockNode is a block along its children, so a whole page is fetched before
+// rendering it.
+type blockNode struct {
+	block    notion.Block
+	children []*blockNode
+	// unavailable is set when the content of a duplicated synced block could
+	// not be fetched from its original
+	unavailable bool
+}
+
+// fetchBlockTree returns the blocks of the page or block with all their
+// descendants.
+func fetchBlockTree(client client.NotionClient, blockID string) ([]*blockNode, error) {
+	blocks, err := findBlockChildren(client, blockID)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchDescendants(client, blocks)
+}
+
+// fetchDescendants returns the tree of the blocks. The children of sibling
+// blocks are fetched concurrently, the rate limiter of the client keeps the
+// requests within the limits of the API.
+func fetchDescendants(c client.NotionClient, blocks []notion.Block) ([]*blockNode, error) {
+	nodes := make([]*blockNode, len(blocks))
+	errs := make([]error, len(blocks))
+
+	var wg sync.WaitGroup
+
+	for i, block := range blocks {
+		nodes[i] = &blockNode{block: block}
+
+		childrenID := childrenOf(block)
+		if childrenID == "" {
+			continue
+		}
+
+		if fetchSlots == nil {
+			children, err := fetchBlockTree(c, childrenID)
+			if err = setChildren(nodes[i], children, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// The slot is taken before starting the goroutine, so there are never
+		// more goroutines requesting children than slots. It is given back
+		// before fetching the descendants, which take their own.
+		fetchSlots <- struct{}{}
+		wg.Add(1)
+		go func(i int, childrenID string) {
+			defer wg.Done()
+
+			children, err := client.FindBlockChildren(context.Background(), c, childrenID)
+			<-fetchSlots
+
+			var tree []*blockNode
+			if err == nil {
+				tree, err = fetchDescendants(c, children)
+			}
+			errs[i] = setChildren(nodes[i], tree, err)
+		}(i, childrenID)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nodes, nil
+}
+
+// setChildren sets the children fetched for the node. Duplicated synced
+// blocks are marked as unavailable when their original can not be fetched.
+func setChildren(node *blockNode, children []*blockNode, err error) error {
+	if err != nil {
+		if synced, ok := node.block.(*notion.SyncedBlock); ok && synced.SyncedFrom != nil {
+			// The integration might not have access to the page holding the original
+			node.unavailable = true
+			return nil
+		}
+		return err
+	}
+
+	node.children = children
+	return nil
+}
+
+// findBlockChildren returns every child of the block, holding a fetch slot
+// while requesting them.
+func findBlockChildren(c client.NotionClient, blockID string) ([]notion.Block, error) {
+	if fetchSlots != nil {
+		fetchSlots <- struct{}{}
+		defer func() { <-fetchSlots }()
+	}
+
+	return client.FindBlockChildren(context.Background(), c, blockID)
+}
+
+// childrenOf returns the ID of the block holding the children rendered with
+// the block. Sub pages are written to their own note, and duplicated synced
+// blocks hold the children of their original.
+func childrenOf(block notion.Block) string {
+	switch b := block.(type) {
+	case *notion.ChildPageBlock, *notion.ChildDatabaseBlock:
+		return ""
+	case *notion.SyncedBlock:
+		if b.SyncedFrom != nil {
+			return b.SyncedFrom.BlockID
+		}
+	}
+
+	if !block.HasChildren() {
+		return ""
+	}
+
+	return block.ID()
+}
+
+// blocksOf returns the blocks of the nodes, without their children.
+func blocksOf(nodes []*blockNode) []notion.Block {
+	blocks := make([]notion.Block, len(nodes))
+	for i, node := range nodes {
+		blocks[i] = node.block
+	}
+	return blocks
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func TestFetchBlockTree_Pagination(t *testing.T) {
+	paragraphs := []string{}
+	for i := 1; i <= 5; i++ {
+		paragraphs = append(paragraphs, blockJSON(fmt.Sprintf("p%d", i), "paragraph", fmt.Sprintf("paragraph %d", i), false))
+	}
+
+	rows := []string{}
+	for i := 1; i <= 5; i++ {
+		rows = append(rows, tableRowJSON(fmt.Sprintf("row-%d", i), cellJSON(fmt.Sprintf("cell %d", i))))
+	}
+
+	fake := &client.Fake{
+		PageSize: 2,
+		Blocks: map[string][]notion.Block{
+			"page": blocksFromJSON(t, "["+
+				strings.Join(paragraphs, ",")+","+
+				`{"object":"block","id":"table","type":"table","has_children":true,"table":{"table_width":1,"has_column_header":true}}`+
+				"]"),
+			"table": blocksFromJSON(t, "["+strings.Join(rows, ",")+"]"),
+		},
+	}
+
+	for _, slots := range []int{0, 2} {
+		fetchSlots = nil
+		if slots > 0 {
+			fetchSlots = make(chan struct{}, slots)
+		}
+
+		nodes, err := fetchBlockTree(fake, "page")
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+
+		if len(nodes) != 6 {
+			t.Fatalf("incorrect blocks expected 6 got: %d", len(nodes))
+		}
+		if _, ok := nodes[5].block.(*notion.TableBlock); !ok || len(nodes[5].children) != 5 {
+			t.Errorf("incorrect table rows expected 5 got: %d", len(nodes[5].children))
+		}
+	}
+	fetchSlots = nil
+
+	result := renderBlocks(t, fake, blocksFromJSON(t, `[{"object":"block","id":"table","type":"table","has_children":true,"table":{"table_width":1,"has_column_header":true}}]`))
+	expected := "| cell 1 |\n" +
+		"| ------ |\n" +
+		"| cell 2 |\n" +
+		"| cell 3 |\n" +
+		"| cell 4 |\n" +
+		"| cell 5 |\n"
+	if result != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+// slowClient records the most requests for children in flight at once and
+// the most goroutines running meanwhile.
+type slowClient struct {
+	*client.Fake
+
+	inFlight, maxInFlight, maxGoroutines int
+	mu                                   sync.Mutex
+}
+
+func (c *slowClient) FindBlockChildrenByID(ctx context.Context, blockID string, query *notion.PaginationQuery) (notion.BlockChildrenResponse, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	if goroutines := runtime.NumGoroutine(); goroutines > c.maxGoroutines {
+		c.maxGoroutines = goroutines
+	}
+	c.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+
+	return c.Fake.FindBlockChildrenByID(ctx, blockID, query)
+}
+
+func TestFetchBlockTree_BoundedGoroutines(t *testing.T) {
+	toggles := []string{}
+	blocks := map[string][]notion.Block{}
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("toggle-%d", i)
+		toggles = append(toggles, blockJSON(id, "toggle", id, true))
+		blocks[id] = blocksFromJSON(t, "["+blockJSON(id+"-item", "bulleted_list_item", "item", true)+"]")
+		blocks[id+"-item"] = blocksFromJSON(t, "["+blockJSON(id+"-nested", "paragraph", "nested", false)+"]")
+	}
+	blocks["page"] = blocksFromJSON(t, "["+strings.Join(toggles, ",")+"]")
+
+	c := &slowClient{Fake: &client.Fake{Blocks: blocks}}
+
+	fetchSlots = make(chan struct{}, 3)
+	defer func() { fetchSlots = nil }()
+
+	baseline := runtime.NumGoroutine()
+
+	nodes, err := fetchBlockTree(c, "page")
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	if len(nodes) != 50 || len(nodes[49].children) != 1 || len(nodes[49].children[0].children) != 1 {
+		t.Fatalf("incorrect tree expected 50 toggles with nested children got: %d", len(nodes))
+	}
+
+	if c.maxInFlight > 3 {
+		t.Errorf("incorrect requests in flight expected at most 3 got: %d", c.maxInFlight)
+	}
+
+	// Each slot holder may have started the goroutines for its own children
+	if goroutines := c.maxGoroutines - baseline; goroutines > 3*3 {
+		t.Errorf("incorrect goroutines expected at most 9 got: %d", goroutines)
+	}
+}
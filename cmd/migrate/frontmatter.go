@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+// Dates keep their offset, so a time is the same instant whatever the time
+// zone of the machine reading the note.
+const (
+	frontMatterDateFormat     = "2006-01-02"
+	frontMatterDateTimeFormat = time.RFC3339
+)
+
+// frontMatterField is a key of the YAML front matter. Values can be nil,
+// strings, numbers, booleans, notion.DateTime, time.Time or lists of those.
+type frontMatterField struct {
+	key   string
+	value interface{}
+	title bool
+}
+
+func propertiesToFrontMatter(client client.NotionClient, page notion.Page, propertites notion.DatabasePageProperties, buffer *bufio.Writer, notePath string) error {
+	fields := []frontMatterField{}
+
+	for key, value := range propertites {
+		fieldValue, ok, err := propertyValue(client, value, notePath)
+		if err != nil {
+			return fmt.Errorf("failed to convert property %s. error: %w", key, err)
+		}
+		if ok {
+			fields = append(fields, frontMatterField{
+				key:   key,
+				value: fieldValue,
+				title: value.Type == notion.DBPropTypeTitle,
+			})
+		}
+	}
+
+	if frontMatterMapping != nil {
+		var err error
+		if fields, err = frontMatterMapping.apply(fields, page); err != nil {
+			return err
+		}
+	}
+
+	if databaseIndexes != nil && page.Parent.Type == notion.ParentTypeDatabase {
+		link, err := databaseIndexes.link(client, page.Parent.DatabaseID)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, frontMatterField{key: databaseKey, value: link})
+	}
+
+	// The page properties come in a map, so we sort them to keep the front
+	// matter stable between runs. The title always goes first.
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].title != fields[j].title {
+			return fields[i].title
+		}
+		return fields[i].key < fields[j].key
+	})
+
+	output.frontMatter(buffer, notePath, page, fields)
+
+	return nil
+}
+
+// propertyValue returns the front matter value of a property, and false for
+// the property types that are not exported.
+func propertyValue(client client.NotionClient, value notion.DatabasePageProperty, notePath string) (interface{}, bool, error) {
+	switch value.Type {
+	case notion.DBPropTypeTitle:
+		return extractPlainTextFromRichText(value.Title), true, nil
+	case notion.DBPropTypeRichText:
+		return extractPlainTextFromRichText(value.RichText), true, nil
+	case notion.DBPropTypeNumber:
+		if value.Number == nil {
+			return nil, true, nil
+		}
+		return *value.Number, true, nil
+	case notion.DBPropTypeSelect:
+		if value.Select == nil {
+			return nil, true, nil
+		}
+		return value.Select.Name, true, nil
+	case notion.DBPropTypeMultiSelect:
+		options := []interface{}{}
+		for _, option := range value.MultiSelect {
+			options = append(options, option.Name)
+		}
+		return options, true, nil
+	case notion.DBPropTypeDate:
+		if value.Date == nil {
+			return nil, true, nil
+		}
+		return value.Date.Start, true, nil
+	case notion.DBPropTypeCheckbox:
+		if value.Checkbox == nil {
+			return false, true, nil
+		}
+		return *value.Checkbox, true, nil
+	case notion.DBPropTypeURL:
+		if *format == formatHTML && value.URL != nil {
+			return htmlLink(output.externalLink(*value.URL, *value.URL)), true, nil
+		}
+		return stringOrNil(value.URL), true, nil
+	case notion.DBPropTypeEmail:
+		return stringOrNil(value.Email), true, nil
+	case notion.DBPropTypePhoneNumber:
+		return stringOrNil(value.PhoneNumber), true, nil
+	case notion.DBPropTypeStatus:
+		if value.Status == nil {
+			return nil, true, nil
+		}
+		return value.Status.Name, true, nil
+	case notion.DBPropTypeRollup:
+		if value.Rollup == nil {
+			return nil, true, nil
+		}
+		switch value.Rollup.Type {
+		case notion.RollupResultTypeNumber:
+			if value.Rollup.Number == nil {
+				return nil, true, nil
+			}
+			return *value.Rollup.Number, true, nil
+		case notion.RollupResultTypeDate:
+			if value.Rollup.Date == nil {
+				return nil, true, nil
+			}
+			return value.Rollup.Date.Start, true, nil
+		case notion.RollupResultTypeArray:
+			items := []interface{}{}
+			for _, item := range value.Rollup.Array {
+				itemValue, ok, err := propertyValue(client, item, notePath)
+				if err != nil {
+					return nil, false, err
+				}
+				if !ok || itemValue == nil {
+					continue
+				}
+				// Rollups of relations, people or multi selects are lists themselves
+				if list, isList := itemValue.([]interface{}); isList {
+					items = append(items, list...)
+				} else {
+					items = append(items, itemValue)
+				}
+			}
+			return items, true, nil
+		}
+	case notion.DBPropTypeFormula:
+		if value.Formula == nil {
+			return nil, true, nil
+		}
+		switch value.Formula.Type {
+		case notion.FormulaResultTypeString:
+			return stringOrNil(value.Formula.String), true, nil
+		case notion.FormulaResultTypeNumber:
+			if value.Formula.Number == nil {
+				return nil, true, nil
+			}
+			return *value.Formula.Number, true, nil
+		case notion.FormulaResultTypeBoolean:
+			if value.Formula.Boolean == nil {
+				return nil, true, nil
+			}
+			return *value.Formula.Boolean, true, nil
+		case notion.FormulaResultTypeDate:
+			if value.Formula.Date == nil {
+				return nil, true, nil
+			}
+			return value.Formula.Date.Start, true, nil
+		}
+	case notion.DBPropTypeRelation:
+		links := []interface{}{}
+		for _, relation := range value.Relation {
+			link, err := relationValue(client, notePath, relation.ID)
+			if err != nil {
+				return nil, false, err
+			}
+			if link != "" {
+				links = append(links, link)
+			}
+		}
+		return links, true, nil
+	case notion.DBPropTypePeople:
+		people := []interface{}{}
+		for _, user := range value.People {
+			if name := userName(user); name != "" {
+				people = append(people, name)
+			}
+		}
+		return people, true, nil
+	case notion.DBPropTypeFiles:
+		files := []interface{}{}
+		for _, file := range value.Files {
+			if *format == formatHTML {
+				link, err := htmlFileLink(notePath, file.Type, file.File, file.External, file.Name)
+				if err != nil {
+					return nil, false, err
+				}
+				if link != "" {
+					files = append(files, link)
+				}
+				continue
+			}
+			link, err := fileLink(notePath, file.Type, file.File, file.External, file.Name, false)
+			if err != nil {
+				return nil, false, err
+			}
+			if link != "" {
+				files = append(files, link)
+			}
+		}
+		return files, true, nil
+	case notion.DBPropTypeCreatedTime:
+		if value.CreatedTime == nil {
+			return nil, true, nil
+		}
+		return *value.CreatedTime, true, nil
+	case notion.DBPropTypeCreatedBy:
+		if value.CreatedBy == nil {
+			return nil, true, nil
+		}
+		return userName(*value.CreatedBy), true, nil
+	case notion.DBPropTypeLastEditedTime:
+		if value.LastEditedTime == nil {
+			return nil, true, nil
+		}
+		return *value.LastEditedTime, true, nil
+	case notion.DBPropTypeLastEditedBy:
+		if value.LastEditedBy == nil {
+			return nil, true, nil
+		}
+		return userName(*value.LastEditedBy), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// userName returns the name of the user, or the email when the integration
+// has no access to the name.
+func userName(user notion.User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+	if user.Person != nil {
+		return user.Person.Email
+	}
+	return ""
+}
+
+func stringOrNil(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func writeFrontMatter(buffer *bufio.Writer, fields []frontMatterField) {
+	buffer.WriteString("---\n")
+	for _, field := range fields {
+		buffer.WriteString(yamlString(field.key))
+		buffer.WriteString(":")
+
+		if list, ok := field.value.([]interface{}); ok {
+			if len(list) == 0 {
+				buffer.WriteString(" []\n")
+				continue
+			}
+			buffer.WriteString("\n")
+			for _, item := range list {
+				buffer.WriteString("  - ")
+				buffer.WriteString(yamlScalar(item))
+				buffer.WriteString("\n")
+			}
+			continue
+		}
+
+		if field.value != nil {
+			buffer.WriteString(" ")
+			buffer.WriteString(yamlScalar(field.value))
+		}
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString("---\n")
+}
+
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return yamlString(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return ".nan"
+		case math.IsInf(v, 1):
+			return ".inf"
+		case math.IsInf(v, -1):
+			return "-.inf"
+		}
+		return plainText(v)
+	case bool, int, notion.DateTime, time.Time:
+		return plainText(v)
+	default:
+		return yamlString(plainText(v))
+	}
+}
+
+// plainText returns the value as text, without any YAML quoting.
+func plainText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case notion.DateTime:
+		if v.HasTime() {
+			return v.Format(frontMatterDateTimeFormat)
+		}
+		return v.Format(frontMatterDateFormat)
+	case time.Time:
+		return v.Format(frontMatterDateTimeFormat)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Plain scalars that YAML would resolve to something other than a string.
+var yamlNonStringPattern = regexp.MustCompile(`^(?i:~|null|true|false|yes|no|on|off|y|n|[-+]?(\.inf|\.nan)|[-+]?[0-9][0-9_]*(\.[0-9_]*)?([eE][-+]?[0-9]+)?|[-+]?\.[0-9]+([eE][-+]?[0-9]+)?|0x[0-9a-f_]+|0o[0-7_]+|[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}.*)$`)
+
+// yamlString returns s as a YAML scalar, quoting it when a plain scalar would
+// be invalid or would not be read back as the same string.
+func yamlString(s string) string {
+	if yamlNeedsQuotes(s) {
+		return yamlQuote(s)
+	}
+	return s
+}
+
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || yamlNonStringPattern.MatchString(s) {
+		return true
+	}
+
+	if strings.TrimSpace(s) != s {
+		return true
+	}
+
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		// A dash, question mark or colon followed by text is still a plain scalar,
+		// but we keep it simple and quote every indicator.
+		return true
+	}
+
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+
+	for _, r := range s {
+		if unicode.IsControl(r) || r == '\uFEFF' {
+			return true
+		}
+	}
+
+	return false
+}
+
+func yamlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if unicode.IsControl(r) || r == '\uFEFF' {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestYamlScalar(t *testing.T) {
+	date, _ := notion.ParseDateTime("2023-04-05")
+	dateTime, _ := notion.ParseDateTime("2023-04-05T10:30:00.000Z")
+	offsetDateTime, _ := notion.ParseDateTime("2023-04-05T10:30:00.000+02:00")
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"plain string", "hello world", "hello world"},
+		{"empty string", "", `""`},
+		{"colon", "Meeting: notes", `"Meeting: notes"`},
+		{"trailing colon", "todo:", `"todo:"`},
+		{"hash", "Issue #42", `"Issue #42"`},
+		{"leading hash", "#tag", `"#tag"`},
+		{"leading dash", "- item", `"- item"`},
+		{"quotes", `say "hi"`, `say "hi"`},
+		{"leading quote", `"quoted"`, `"\"quoted\""`},
+		{"newline", "line\nbreak", `"line\nbreak"`},
+		{"boolean like", "yes", `"yes"`},
+		{"number like", "3.14", `"3.14"`},
+		{"date like", "2023-04-05", `"2023-04-05"`},
+		{"null like", "null", `"null"`},
+		{"leading space", " padded", `" padded"`},
+		{"integer number", 3.0, "3"},
+		{"decimal number", 3.25, "3.25"},
+		{"boolean", true, "true"},
+		{"nil", nil, "null"},
+		{"date", date, "2023-04-05"},
+		{"date time", dateTime, "2023-04-05T10:30:00Z"},
+		{"date time with offset", offsetDateTime, "2023-04-05T10:30:00+02:00"},
+		{"time", time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC), "2023-04-05T10:30:00Z"},
+		{"time with offset", time.Date(2023, 4, 5, 10, 30, 0, 0, time.FixedZone("", -5*60*60)), "2023-04-05T10:30:00-05:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := yamlScalar(test.value)
+			if result != test.expected {
+				t.Errorf("incorrect result expected '%s' got: %s", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestPropertiesToFrontMatter_ComputedValues(t *testing.T) {
+	b := &bytes.Buffer{}
+	buffer := bufio.NewWriter(b)
+
+	formula := "done: 3"
+	total := 12.5
+
+	properties := notion.DatabasePageProperties{
+		"Owners": {
+			Type: notion.DBPropTypePeople,
+			People: []notion.User{
+				{Name: "Gustavo"},
+				{Person: &notion.Person{Email: "someone@example.com"}},
+			},
+		},
+		"Progress": {
+			Type:    notion.DBPropTypeFormula,
+			Formula: &notion.FormulaResult{Type: notion.FormulaResultTypeString, String: &formula},
+		},
+		"Total": {
+			Type:    notion.DBPropTypeFormula,
+			Formula: &notion.FormulaResult{Type: notion.FormulaResultTypeNumber, Number: &total},
+		},
+		"Habits": {
+			Type: notion.DBPropTypeRollup,
+			Rollup: &notion.RollupResult{
+				Type: notion.RollupResultTypeArray,
+				Array: []notion.DatabasePageProperty{
+					{Type: notion.DBPropTypeMultiSelect, MultiSelect: []notion.SelectOptions{{Name: "run"}, {Name: "read"}}},
+					{Type: notion.DBPropTypeRichText, RichText: []notion.RichText{{PlainText: "swim"}}},
+				},
+			},
+		},
+		"Files": {
+			Type: notion.DBPropTypeFiles,
+			Files: []notion.File{
+				{Name: "spec", Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: "https://example.com/spec.pdf"}},
+			},
+		},
+	}
+
+	if err := propertiesToFrontMatter(nil, notion.Page{}, properties, buffer, "note.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := buffer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `---
+Files:
+  - "[spec](https://example.com/spec.pdf)"
+Habits:
+  - run
+  - read
+  - swim
+Owners:
+  - Gustavo
+  - someone@example.com
+Progress: "done: 3"
+Total: 12.5
+---
+`
+
+	if b.String() != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestPropertiesToFrontMatter(t *testing.T) {
+	b := &bytes.Buffer{}
+	buffer := bufio.NewWriter(b)
+
+	done := true
+	rating := 4.0
+	date, _ := notion.ParseDateTime("2023-04-05")
+
+	properties := notion.DatabasePageProperties{
+		"Tags": {
+			Type:        notion.DBPropTypeMultiSelect,
+			MultiSelect: []notion.SelectOptions{{Name: "work"}, {Name: "a: b"}},
+		},
+		"Name": {
+			Type:  notion.DBPropTypeTitle,
+			Title: []notion.RichText{{PlainText: "Week: 1 #2"}},
+		},
+		"Done":   {Type: notion.DBPropTypeCheckbox, Checkbox: &done},
+		"Rating": {Type: notion.DBPropTypeNumber, Number: &rating},
+		"Date":   {Type: notion.DBPropTypeDate, Date: &notion.Date{Start: date}},
+		"URL":    {Type: notion.DBPropTypeURL},
+		"Email":  {Type: notion.DBPropTypeEmail},
+		"Phone":  {Type: notion.DBPropTypePhoneNumber},
+		"Empty":  {Type: notion.DBPropTypeMultiSelect},
+	}
+
+	if err := propertiesToFrontMatter(nil, notion.Page{}, properties, buffer, "note.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := buffer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `---
+Name: "Week: 1 #2"
+Date: 2023-04-05
+Done: true
+Email:
+Empty: []
+Phone:
+Rating: 4
+Tags:
+  - work
+  - "a: b"
+URL:
+---
+`
+
+	if b.String() != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
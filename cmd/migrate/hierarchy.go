@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+// pageTree mirrors the Notion page hierarchy in the vault. The children of a
+// page go into a folder named after it, next to its note or, with folder
+// notes, around it.
+type pageTree struct {
+	folderNotes bool
+}
+
+var hierarchy *pageTree
+
+// pagePath returns the path of the page within the folder of its parent.
+func (t *pageTree) pagePath(client client.NotionClient, page notion.Page) (string, error) {
+	if path, ok := pagePaths.pathOf(page.ID); ok {
+		return path, nil
+	}
+
+	folder, err := t.folder(client, page.Parent)
+	if err != nil {
+		return "", err
+	}
+
+	return pagePaths.assign(page.ID, filepath.Join(folder, sanitizeFileName(pageTitle(page))+noteExtension))
+}
+
+// folder returns the folder holding the children of parent.
+func (t *pageTree) folder(client client.NotionClient, parent notion.Parent) (string, error) {
+	switch parent.Type {
+	case notion.ParentTypePage:
+		if path, ok := pagePaths.pathOf(parent.PageID); ok {
+			return childFolder(path), nil
+		}
+
+		parentPage, err := client.FindPageByID(context.Background(), parent.PageID)
+		if err != nil {
+			return "", fmt.Errorf("failed to find parent page %s. error: %w", parent.PageID, err)
+		}
+
+		path, err := t.pagePath(client, parentPage)
+		if err != nil {
+			return "", err
+		}
+
+		return childFolder(path), nil
+	case notion.ParentTypeDatabase:
+		// The pages of the migrated database are placed with -path
+		if parent.DatabaseID == *databaseID {
+			return *obsidianVault, nil
+		}
+
+		db, err := client.FindDatabaseByID(context.Background(), parent.DatabaseID)
+		if err != nil {
+			return "", fmt.Errorf("failed to find parent database %s. error: %w", parent.DatabaseID, err)
+		}
+
+		folder, err := t.folder(client, db.Parent)
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(folder, sanitizeFileName(extractPlainTextFromRichText(db.Title))), nil
+	case notion.ParentTypeBlock:
+		// Pages nested in blocks, e.g. in a toggle, belong to the page holding the block
+		block, err := client.FindBlockByID(context.Background(), parent.BlockID)
+		if err != nil {
+			return "", fmt.Errorf("failed to find parent block %s. error: %w", parent.BlockID, err)
+		}
+
+		return t.folder(client, block.Parent())
+	}
+
+	return *obsidianVault, nil
+}
+
+// notePath returns where the note of a page with the given blocks goes. With
+// folder notes, pages with sub pages are written inside their folder.
+func (t *pageTree) notePath(pageID, path string, blocks []notion.Block) string {
+	if !t.folderNotes {
+		return path
+	}
+
+	for _, block := range blocks {
+		if _, ok := block.(*notion.ChildPageBlock); ok {
+			path = folderNotePath(path)
+			pagePaths.move(pageID, path)
+			break
+		}
+	}
+
+	return path
+}
+
+// childFolder returns the folder for the children of the note at path.
+func childFolder(path string) string {
+	dir, file := filepath.Split(path)
+	name := strings.TrimSuffix(file, noteExtension)
+
+	// The note is already the folder note
+	if filepath.Base(dir) == name {
+		return filepath.Clean(dir)
+	}
+
+	return filepath.Join(dir, name)
+}
+
+func folderNotePath(path string) string {
+	return filepath.Join(childFolder(path), filepath.Base(path))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func titledPage(id string, parent notion.Parent, title string) notion.Page {
+	return notion.Page{
+		ID:         id,
+		Parent:     parent,
+		Properties: notion.PageProperties{Title: notion.PageTitle{Title: []notion.RichText{{PlainText: title}}}},
+	}
+}
+
+func TestPageTree_PagePath(t *testing.T) {
+	vault, paths := *obsidianVault, pagePaths
+	*obsidianVault = "vault"
+	defer func() { *obsidianVault, pagePaths = vault, paths }()
+
+	var err error
+	if pagePaths, err = newNotePaths("vault", collisionSuffix, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &client.Fake{
+		Pages: map[string]notion.Page{
+			"root":    titledPage("root", notion.Parent{Type: notion.ParentTypeWorkspace}, "Root"),
+			"child":   titledPage("child", notion.Parent{Type: notion.ParentTypePage, PageID: "root"}, "Child: draft"),
+			"nested":  titledPage("nested", notion.Parent{Type: notion.ParentTypeBlock, BlockID: "toggle"}, "Nested"),
+			"other":   titledPage("other", notion.Parent{Type: notion.ParentTypeWorkspace}, "Nested"),
+			"in-db":   {ID: "in-db", Parent: notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: "db"}, Properties: notion.DatabasePageProperties{"Title": {Type: notion.DBPropTypeTitle, Title: []notion.RichText{{PlainText: "Entry"}}}}},
+			"db-page": titledPage("db-page", notion.Parent{Type: notion.ParentTypeWorkspace}, "Wiki"),
+		},
+		Databases: map[string]notion.Database{
+			"db": {ID: "db", Title: []notion.RichText{{PlainText: "Tasks"}}, Parent: notion.Parent{Type: notion.ParentTypePage, PageID: "db-page"}},
+		},
+		Blocks: map[string][]notion.Block{
+			"child": blocksFromJSON(t, `[{"object":"block","id":"toggle","type":"toggle","parent":{"type":"page_id","page_id":"child"},"toggle":{"rich_text":[]}}]`),
+		},
+	}
+
+	tree := &pageTree{}
+
+	tests := []struct {
+		pageID   string
+		expected string
+	}{
+		{"nested", "vault/Root/Child- draft/Nested.md"},
+		{"root", "vault/Root.md"},
+		{"other", "vault/Nested.md"},
+		{"in-db", "vault/Wiki/Tasks/Entry.md"},
+	}
+
+	for _, test := range tests {
+		path, err := tree.pagePath(fake, fake.Pages[test.pageID])
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+		if path != filepath.FromSlash(test.expected) {
+			t.Errorf("incorrect path for %s expected %q got: %q", test.pageID, test.expected, path)
+		}
+	}
+
+	if link := pagePaths.link("nested", "Nested"); link != "[[Root/Child- draft/Nested|Nested]]" {
+		t.Errorf("expected a path qualified link got: %s", link)
+	}
+	if link := pagePaths.link("child", "Child: draft"); link != "[[Child- draft|Child: draft]]" {
+		t.Errorf("expected a link to the file name got: %s", link)
+	}
+
+	tree.folderNotes = true
+	blocks := blocksFromJSON(t, `[{"object":"block","id":"child","type":"child_page","child_page":{"title":"Child: draft"}}]`)
+	if path := tree.notePath("root", filepath.FromSlash("vault/Root.md"), blocks); path != filepath.FromSlash("vault/Root/Root.md") {
+		t.Errorf("expected a folder note got: %s", path)
+	}
+	if folder := childFolder(filepath.FromSlash("vault/Root/Root.md")); folder != filepath.FromSlash("vault/Root") {
+		t.Errorf("expected the folder of the folder note got: %s", folder)
+	}
+}
@@ -0,0 +1,639 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+const formatHTML = "html"
+
+// htmlSite writes every page as an HTML document of a static site, the vault
+// being its root. The front matter opens the document with the properties of
+// the page and the body closes it. Only the links and references of the
+// markdown renderers are used, the blocks are written by htmlPage.
+type htmlSite struct {
+	commonMark
+}
+
+func (htmlSite) writeBody(client client.NotionClient, nodes []*blockNode, buffer *bufio.Writer, notePath string) error {
+	page := &htmlPage{
+		client:   client,
+		notePath: notePath,
+		anchors:  map[string]string{},
+	}
+	page.collectHeadings(nodes, map[string]int{})
+
+	if err := page.writeBlocks(buffer, nodes); err != nil {
+		return err
+	}
+
+	buffer.WriteString("</main>\n</body>\n</html>\n")
+
+	return nil
+}
+
+func (htmlSite) frontMatter(buffer *bufio.Writer, notePath string, page notion.Page, fields []frontMatterField) {
+	title := html.EscapeString(pageTitle(page))
+
+	writeHTMLHead(buffer, notePath, title)
+	buffer.WriteString("<main>\n")
+	buffer.WriteString("<h1>" + title + "</h1>\n")
+
+	rows := []string{}
+	for _, field := range fields {
+		if field.title || field.value == nil {
+			continue
+		}
+		rows = append(rows, fmt.Sprintf("<tr><th>%s</th><td>%s</td></tr>", html.EscapeString(field.key), htmlValue(field.value)))
+	}
+
+	if len(rows) > 0 {
+		buffer.WriteString("<table class=\"properties\">\n")
+		buffer.WriteString(strings.Join(rows, "\n"))
+		buffer.WriteString("\n</table>\n")
+	}
+}
+
+// writeHTMLHead opens the document at notePath, linking to the style sheet
+// and the index at the root of the site.
+func writeHTMLHead(buffer *bufio.Writer, notePath, title string) {
+	buffer.WriteString("<!DOCTYPE html>\n")
+	buffer.WriteString("<html>\n<head>\n")
+	buffer.WriteString("<meta charset=\"utf-8\">\n")
+	buffer.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	buffer.WriteString("<title>" + title + "</title>\n")
+	buffer.WriteString(fmt.Sprintf("<link rel=\"stylesheet\" href=\"%s\">\n", siteHref(notePath, siteStyleFile)))
+	buffer.WriteString("</head>\n<body>\n")
+	buffer.WriteString(fmt.Sprintf("<nav class=\"site\"><a href=\"%s\">Index</a></nav>\n", siteHref(notePath, siteIndexFile)))
+}
+
+func (htmlSite) link(notePath, pageID, path, title string) string {
+	target, err := filepath.Rel(filepath.Dir(notePath), path)
+	if err != nil {
+		target = path
+	}
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", htmlHref(target), html.EscapeString(title))
+}
+
+func (htmlSite) externalLink(title, url string) string {
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(url), html.EscapeString(title))
+}
+
+func (htmlSite) reference(name string) string {
+	return html.EscapeString(name)
+}
+
+func (htmlSite) placeholder(text string) string {
+	return "<aside class=\"callout callout-warning\"><p>" + html.EscapeString(text) + "</p></aside>"
+}
+
+// htmlHref returns the URL of a relative path, escaped for an attribute.
+func htmlHref(relative string) string {
+	return html.EscapeString(relativeURL(relative))
+}
+
+// relativeURL returns the URL of a relative path. Paths starting with a
+// segment like "Meeting: notes" are kept relative.
+func relativeURL(relative string) string {
+	u := &url.URL{Path: filepath.ToSlash(relative)}
+	return u.String()
+}
+
+// siteHref returns the URL of a file at the root of the site from the note at
+// notePath.
+func siteHref(notePath, name string) string {
+	target, err := filepath.Rel(filepath.Dir(notePath), filepath.Join(*obsidianVault, name))
+	if err != nil {
+		target = name
+	}
+	return htmlHref(target)
+}
+
+// htmlFileHref returns the URL of a file object from the note at notePath,
+// escaped for an attribute. Files hosted by Notion are downloaded next to the
+// pages.
+func htmlFileHref(notePath string, fileType notion.FileType, file *notion.FileFile, external *notion.FileExternal) (string, error) {
+	switch fileType {
+	case notion.FileTypeExternal:
+		return html.EscapeString(external.URL), nil
+	case notion.FileTypeFile:
+		if attachmentStore == nil {
+			return html.EscapeString(file.URL), nil
+		}
+		name, err := attachmentStore.save(file.URL)
+		if err != nil {
+			return "", err
+		}
+		return htmlHref(attachmentStore.relative(notePath, name)), nil
+	}
+	return "", nil
+}
+
+// htmlLink is a property value already written as HTML, which htmlValue
+// leaves as it is.
+type htmlLink string
+
+// htmlFileLink returns the link to a file object of a property, named after
+// the file when it has no name.
+func htmlFileLink(notePath string, fileType notion.FileType, file *notion.FileFile, external *notion.FileExternal, title string) (htmlLink, error) {
+	href, err := htmlFileHref(notePath, fileType, file, external)
+	if err != nil || href == "" {
+		return "", err
+	}
+	if title == "" {
+		if u, err := url.Parse(html.UnescapeString(href)); err == nil {
+			title = path.Base(u.Path)
+		}
+	}
+	return htmlLink(fmt.Sprintf("<a href=\"%s\">%s</a>", href, html.EscapeString(title))), nil
+}
+
+// htmlValue returns a property value as HTML, lists separated by commas.
+func htmlValue(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+
+	items := []string{}
+	for _, item := range list {
+		if link, isLink := item.(htmlLink); isLink {
+			items = append(items, string(link))
+			continue
+		}
+		if text := plainText(item); text != "" {
+			items = append(items, html.EscapeString(text))
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+type htmlHeading struct {
+	level  int
+	text   string
+	anchor string
+}
+
+// htmlPage writes the block tree of a page as HTML.
+type htmlPage struct {
+	client   client.NotionClient
+	notePath string
+	// anchors are the IDs of the headings by block ID
+	anchors  map[string]string
+	headings []htmlHeading
+}
+
+// collectHeadings gives every heading a unique anchor, so the table of
+// contents can be written before the headings.
+func (p *htmlPage) collectHeadings(nodes []*blockNode, used map[string]int) {
+	for _, node := range nodes {
+		level := 0
+		var richText []notion.RichText
+
+		switch block := node.block.(type) {
+		case *notion.Heading1Block:
+			level, richText = 1, block.RichText
+		case *notion.Heading2Block:
+			level, richText = 2, block.RichText
+		case *notion.Heading3Block:
+			level, richText = 3, block.RichText
+		}
+
+		if level > 0 {
+			text := extractPlainTextFromRichText(richText)
+			anchor := headingSlug(text)
+			if anchor == "" {
+				anchor = "section"
+			}
+			used[anchor]++
+			if used[anchor] > 1 {
+				anchor = fmt.Sprintf("%s-%d", anchor, used[anchor]-1)
+			}
+
+			p.anchors[node.block.ID()] = anchor
+			p.headings = append(p.headings, htmlHeading{level: level, text: text, anchor: anchor})
+		}
+
+		p.collectHeadings(node.children, used)
+	}
+}
+
+// writeBlocks writes the blocks, grouping consecutive list items in a list.
+func (p *htmlPage) writeBlocks(buffer *bufio.Writer, nodes []*blockNode) error {
+	list := ""
+
+	for _, node := range nodes {
+		kind := ""
+		switch node.block.(type) {
+		case *notion.BulletedListItemBlock:
+			kind = "<ul>"
+		case *notion.NumberedListItemBlock:
+			kind = "<ol>"
+		case *notion.ToDoBlock:
+			kind = "<ul class=\"todo\">"
+		}
+
+		if kind != list {
+			closeHTMLList(buffer, list)
+			if kind != "" {
+				buffer.WriteString(kind)
+				buffer.WriteString("\n")
+			}
+			list = kind
+		}
+
+		if err := p.writeBlock(buffer, node); err != nil {
+			return err
+		}
+	}
+
+	closeHTMLList(buffer, list)
+
+	return nil
+}
+
+func closeHTMLList(buffer *bufio.Writer, list string) {
+	switch list {
+	case "":
+	case "<ol>":
+		buffer.WriteString("</ol>\n")
+	default:
+		buffer.WriteString("</ul>\n")
+	}
+}
+
+func (p *htmlPage) writeBlock(buffer *bufio.Writer, node *blockNode) error {
+	switch block := node.block.(type) {
+	case *notion.Heading1Block:
+		return p.writeHeading(buffer, node, "h2", block.RichText)
+	case *notion.Heading2Block:
+		return p.writeHeading(buffer, node, "h3", block.RichText)
+	case *notion.Heading3Block:
+		return p.writeHeading(buffer, node, "h4", block.RichText)
+	case *notion.ParagraphBlock:
+		text, err := p.richText(block.RichText)
+		if err != nil {
+			return err
+		}
+		if text != "" {
+			buffer.WriteString("<p>" + text + "</p>\n")
+		}
+		if len(node.children) > 0 {
+			return p.writeWrapped(buffer, "<div class=\"indented\">", "</div>", node.children)
+		}
+	case *notion.BulletedListItemBlock:
+		return p.writeListItem(buffer, node, "", block.RichText)
+	case *notion.NumberedListItemBlock:
+		return p.writeListItem(buffer, node, "", block.RichText)
+	case *notion.ToDoBlock:
+		checkbox := "<input type=\"checkbox\" disabled> "
+		if block.Checked != nil && *block.Checked {
+			checkbox = "<input type=\"checkbox\" checked disabled> "
+		}
+		return p.writeListItem(buffer, node, checkbox, block.RichText)
+	case *notion.CalloutBlock:
+		text, err := p.richText(block.RichText)
+		if err != nil {
+			return err
+		}
+		icon := ""
+		if block.Icon != nil && block.Icon.Emoji != nil {
+			icon = "<span class=\"icon\">" + html.EscapeString(*block.Icon.Emoji) + "</span> "
+		}
+		buffer.WriteString(fmt.Sprintf("<aside class=\"callout callout-%s\">\n", calloutType(block.Icon)))
+		buffer.WriteString("<p>" + icon + text + "</p>\n")
+		return p.writeWrapped(buffer, "", "</aside>", node.children)
+	case *notion.ToggleBlock:
+		return p.writeDetails(buffer, node, "<details>", block.RichText)
+	case *notion.TemplateBlock:
+		return p.writeDetails(buffer, node, "<details class=\"template\">", block.RichText)
+	case *notion.QuoteBlock:
+		text, err := p.richText(block.RichText)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString("<blockquote>\n<p>" + text + "</p>\n")
+		return p.writeWrapped(buffer, "", "</blockquote>", node.children)
+	case *notion.DividerBlock:
+		buffer.WriteString("<hr>\n")
+	case *notion.ChildPageBlock:
+		// The block ID is the ID of the sub page
+		link, err := pageLink(p.client, p.notePath, block.ID(), block.Title)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString("<p class=\"page\">" + link + "</p>\n")
+	case *notion.LinkToPageBlock:
+		link, err := pageLink(p.client, p.notePath, block.PageID, "")
+		if err != nil {
+			return err
+		}
+		buffer.WriteString("<p class=\"page\">" + link + "</p>\n")
+	case *notion.ChildDatabaseBlock:
+		buffer.WriteString("<p class=\"database\">" + html.EscapeString(block.Title) + "</p>\n")
+	case *notion.CodeBlock:
+		class := ""
+		if block.Language != nil && *block.Language != "" {
+			class = fmt.Sprintf(" class=\"language-%s\"", html.EscapeString(*block.Language))
+		}
+		buffer.WriteString(fmt.Sprintf("<pre><code%s>%s</code></pre>\n", class, html.EscapeString(extractPlainTextFromRichText(block.RichText))))
+	case *notion.EquationBlock:
+		buffer.WriteString("<div class=\"equation\">" + html.EscapeString(block.Expression) + "</div>\n")
+	case *notion.ImageBlock:
+		return p.writeFile(buffer, "image", block.Type, block.File, block.External, block.Caption)
+	case *notion.VideoBlock:
+		return p.writeFile(buffer, "video", block.Type, block.File, block.External, block.Caption)
+	case *notion.AudioBlock:
+		return p.writeFile(buffer, "audio", block.Type, block.File, block.External, block.Caption)
+	case *notion.PDFBlock:
+		return p.writeFile(buffer, "pdf", block.Type, block.File, block.External, block.Caption)
+	case *notion.FileBlock:
+		return p.writeFile(buffer, "file", block.Type, block.File, block.External, block.Caption)
+	case *notion.EmbedBlock:
+		buffer.WriteString(fmt.Sprintf("<p class=\"embed\"><a href=\"%[1]s\">%[1]s</a></p>\n", html.EscapeString(block.URL)))
+	case *notion.BookmarkBlock:
+		buffer.WriteString(fmt.Sprintf("<p class=\"bookmark\"><a href=\"%[1]s\">%[1]s</a></p>\n", html.EscapeString(block.URL)))
+	case *notion.LinkPreviewBlock:
+		buffer.WriteString(fmt.Sprintf("<p class=\"bookmark\"><a href=\"%[1]s\">%[1]s</a></p>\n", html.EscapeString(block.URL)))
+	case *notion.ColumnListBlock:
+		return p.writeWrapped(buffer, "<div class=\"columns\">", "</div>", node.children)
+	case *notion.ColumnBlock:
+		return p.writeWrapped(buffer, "<div class=\"column\">", "</div>", node.children)
+	case *notion.TableBlock:
+		return p.writeTable(buffer, block, node.children)
+	case *notion.SyncedBlock:
+		if node.unavailable {
+			writePlaceholder(buffer, "", fmt.Sprintf("Synced block %s is not accessible", block.SyncedFrom.BlockID))
+			return nil
+		}
+		return p.writeBlocks(buffer, node.children)
+	case *notion.BreadcrumbBlock:
+		// The breadcrumb is written as text, the titles being escaped by the
+		// references of htmlSite
+		b := &bytes.Buffer{}
+		breadcrumb := bufio.NewWriter(b)
+		if err := writeBreadcrumb(p.client, block, breadcrumb, ""); err != nil {
+			return err
+		}
+		if err := breadcrumb.Flush(); err != nil {
+			return err
+		}
+		buffer.WriteString("<nav class=\"breadcrumb\">" + strings.TrimSuffix(b.String(), "\n") + "</nav>\n")
+	case *notion.TableOfContentsBlock:
+		p.writeTableOfContents(buffer)
+	default:
+		// Unknown blocks should not prevent migrating the rest of the page
+		writePlaceholder(buffer, "", fmt.Sprintf("Unsupported block: %s", blockType(block)))
+	}
+
+	return nil
+}
+
+func (p *htmlPage) writeHeading(buffer *bufio.Writer, node *blockNode, tag string, richText []notion.RichText) error {
+	text, err := p.richText(richText)
+	if err != nil {
+		return err
+	}
+
+	buffer.WriteString(fmt.Sprintf("<%s id=\"%s\">%s</%s>\n", tag, html.EscapeString(p.anchors[node.block.ID()]), text, tag))
+
+	// Toggle headings hold their content as children, which belongs under
+	// the heading
+	return p.writeBlocks(buffer, node.children)
+}
+
+func (p *htmlPage) writeListItem(buffer *bufio.Writer, node *blockNode, marker string, richText []notion.RichText) error {
+	text, err := p.richText(richText)
+	if err != nil {
+		return err
+	}
+
+	buffer.WriteString("<li>" + marker + text)
+	if len(node.children) > 0 {
+		buffer.WriteString("\n")
+		if err = p.writeBlocks(buffer, node.children); err != nil {
+			return err
+		}
+	}
+	buffer.WriteString("</li>\n")
+
+	return nil
+}
+
+func (p *htmlPage) writeDetails(buffer *bufio.Writer, node *blockNode, opener string, richText []notion.RichText) error {
+	text, err := p.richText(richText)
+	if err != nil {
+		return err
+	}
+
+	buffer.WriteString(opener + "\n<summary>" + text + "</summary>\n")
+	return p.writeWrapped(buffer, "", "</details>", node.children)
+}
+
+// writeWrapped writes the blocks between opener and closer. An empty opener
+// continues an element already opened.
+func (p *htmlPage) writeWrapped(buffer *bufio.Writer, opener, closer string, nodes []*blockNode) error {
+	if opener != "" {
+		buffer.WriteString(opener)
+		buffer.WriteString("\n")
+	}
+
+	if err := p.writeBlocks(buffer, nodes); err != nil {
+		return err
+	}
+
+	buffer.WriteString(closer)
+	buffer.WriteString("\n")
+
+	return nil
+}
+
+// writeFile writes a file block, downloading the files hosted by Notion next
+// to the pages.
+func (p *htmlPage) writeFile(buffer *bufio.Writer, kind string, fileType notion.FileType, file *notion.FileFile, external *notion.FileExternal, caption []notion.RichText) error {
+	src, err := htmlFileHref(p.notePath, fileType, file, external)
+	if err != nil {
+		return fmt.Errorf("failed to write file block. error: %w", err)
+	}
+	if src == "" {
+		return nil
+	}
+
+	text, err := p.richText(caption)
+	if err != nil {
+		return err
+	}
+
+	buffer.WriteString("<figure>\n")
+	switch kind {
+	case "image":
+		buffer.WriteString(fmt.Sprintf("<img src=\"%s\" alt=\"%s\">\n", src, html.EscapeString(extractPlainTextFromRichText(caption))))
+	case "video":
+		buffer.WriteString(fmt.Sprintf("<video controls src=\"%s\"></video>\n", src))
+	case "audio":
+		buffer.WriteString(fmt.Sprintf("<audio controls src=\"%s\"></audio>\n", src))
+	default:
+		// Links to files need some text to be clickable
+		title := text
+		if title == "" {
+			if u, err := url.Parse(html.UnescapeString(src)); err == nil {
+				title = html.EscapeString(path.Base(u.Path))
+			}
+		}
+		buffer.WriteString(fmt.Sprintf("<a href=\"%s\">%s</a>\n", src, title))
+		text = ""
+	}
+	if text != "" {
+		buffer.WriteString("<figcaption>" + text + "</figcaption>\n")
+	}
+	buffer.WriteString("</figure>\n")
+
+	return nil
+}
+
+func (p *htmlPage) writeTable(buffer *bufio.Writer, block *notion.TableBlock, children []*blockNode) error {
+	buffer.WriteString("<table>\n")
+
+	rowIndex := 0
+	for _, child := range children {
+		row, ok := child.block.(*notion.TableRowBlock)
+		if !ok {
+			continue
+		}
+
+		buffer.WriteString("<tr>")
+		for i := 0; i < block.TableWidth; i++ {
+			text := ""
+			if i < len(row.Cells) {
+				var err error
+				if text, err = p.richText(row.Cells[i]); err != nil {
+					return err
+				}
+			}
+
+			tag := "td"
+			if (block.HasColumnHeader && rowIndex == 0) || (block.HasRowHeader && i == 0) {
+				tag = "th"
+			}
+			buffer.WriteString(fmt.Sprintf("<%s>%s</%s>", tag, text, tag))
+		}
+		buffer.WriteString("</tr>\n")
+		rowIndex++
+	}
+
+	buffer.WriteString("</table>\n")
+
+	return nil
+}
+
+func (p *htmlPage) writeTableOfContents(buffer *bufio.Writer) {
+	if len(p.headings) == 0 {
+		return
+	}
+
+	buffer.WriteString("<nav class=\"toc\">\n<ul>\n")
+	for _, heading := range p.headings {
+		buffer.WriteString(fmt.Sprintf("<li class=\"toc-%d\"><a href=\"#%s\">%s</a></li>\n", heading.level, html.EscapeString(heading.anchor), html.EscapeString(heading.text)))
+	}
+	buffer.WriteString("</ul>\n</nav>\n")
+}
+
+// richText returns the rich text as HTML. Unlike markdown, each piece of text
+// can be wrapped in its annotations on its own.
+func (p *htmlPage) richText(richText []notion.RichText) (string, error) {
+	b := &strings.Builder{}
+
+	for _, text := range richText {
+		var s string
+
+		switch text.Type {
+		case notion.RichTextTypeText:
+			s = htmlText(text.Text.Content)
+			if link := text.Text.Link; link != nil {
+				if strings.HasPrefix(link.URL, "/") {
+					// Link to internal Notion page
+					pageLink, err := pageLink(p.client, p.notePath, strings.TrimPrefix(link.URL, "/"), text.Text.Content)
+					if err != nil {
+						return "", err
+					}
+					s = pageLink
+				} else {
+					s = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(link.URL), s)
+				}
+			}
+		case notion.RichTextTypeMention:
+			switch text.Mention.Type {
+			case notion.MentionTypePage:
+				pageLink, err := pageLink(p.client, p.notePath, text.Mention.Page.ID, text.PlainText)
+				if err != nil {
+					return "", err
+				}
+				s = pageLink
+			case notion.MentionTypeDate:
+				date := text.Mention.Date.Start.Format("2006-01-02")
+				s = fmt.Sprintf("<time datetime=\"%[1]s\">%[1]s</time>", date)
+			case notion.MentionTypeLinkPreview:
+				s = fmt.Sprintf("<a href=\"%[1]s\">%[1]s</a>", html.EscapeString(text.Mention.LinkPreview.URL))
+			case notion.MentionTypeTemplateMention:
+			default:
+				s = html.EscapeString(text.PlainText)
+			}
+		case notion.RichTextTypeEquation:
+			s = "<span class=\"equation\">" + html.EscapeString(text.Equation.Expression) + "</span>"
+		}
+
+		if s == "" {
+			continue
+		}
+
+		b.WriteString(htmlAnnotations(s, text.Annotations))
+	}
+
+	return b.String(), nil
+}
+
+// htmlText escapes the text, keeping its line breaks.
+func htmlText(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>\n")
+}
+
+func htmlAnnotations(s string, annotations *notion.Annotations) string {
+	if annotations == nil {
+		return s
+	}
+
+	if annotations.Code {
+		s = "<code>" + s + "</code>"
+	}
+	if annotations.Bold {
+		s = "<strong>" + s + "</strong>"
+	}
+	if annotations.Italic {
+		s = "<em>" + s + "</em>"
+	}
+	if annotations.Strikethrough {
+		s = "<s>" + s + "</s>"
+	}
+	if annotations.Underline {
+		s = "<u>" + s + "</u>"
+	}
+
+	// Background colors become highlights, text colors keep their color
+	color := string(annotations.Color)
+	if strings.HasSuffix(color, "_background") {
+		s = "<mark>" + s + "</mark>"
+	} else if color != "" && annotations.Color != notion.ColorDefault {
+		s = fmt.Sprintf("<span style=\"color: %s\">%s</span>", html.EscapeString(color), s)
+	}
+
+	return s
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+const (
+	indexDataview = "dataview"
+	indexBase     = "base"
+	indexNone     = "none"
+
+	// databaseKey is the front matter key linking the pages to the index note
+	// of their database, which is how the index finds them.
+	databaseKey = "notion_database"
+)
+
+var dataviewIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// indexes generates a note for each migrated database listing its pages as a
+// table, either with a Dataview query or as an Obsidian base. The API does not
+// expose the views of a database, so the table shows every exported property.
+type indexes struct {
+	vault  string
+	format string
+
+	databases map[string]*databaseIndex
+	mu        sync.Mutex
+}
+
+type databaseIndex struct {
+	database notion.Database
+	include  map[string]bool
+	skip     map[string]bool
+	path     string
+}
+
+var databaseIndexes *indexes
+
+func newIndexes(vault, format string) (*indexes, error) {
+	switch format {
+	case indexNone:
+		return nil, nil
+	case indexDataview, indexBase:
+	default:
+		return nil, fmt.Errorf("unsupported index format %q. use %s, %s or %s", format, indexDataview, indexBase, indexNone)
+	}
+
+	return &indexes{
+		vault:     vault,
+		format:    format,
+		databases: map[string]*databaseIndex{},
+	}, nil
+}
+
+// add records a migrated database along the properties exported from its
+// pages. Databases are only fetched the first time, when the path of their
+// index note is reserved so no page is written there.
+func (x *indexes) add(client client.NotionClient, databaseID string, include, skip map[string]bool) (*databaseIndex, error) {
+	x.mu.Lock()
+	index, ok := x.databases[databaseID]
+	x.mu.Unlock()
+	if ok {
+		return index, nil
+	}
+
+	db, err := client.FindDatabaseByID(context.Background(), databaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find database %s. error: %w", databaseID, err)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if index, ok = x.databases[databaseID]; ok {
+		return index, nil
+	}
+
+	index = &databaseIndex{
+		database: db,
+		include:  include,
+		skip:     skip,
+	}
+
+	fileName := x.fileName(index)
+	if x.format != indexBase {
+		fileName += ".md"
+	}
+	// Databases and pages never share an ID, so the index takes the path
+	// under the ID of its database
+	if index.path, err = pagePaths.assign(databaseID, filepath.Join(x.vault, fileName)); err != nil {
+		return nil, fmt.Errorf("failed to reserve the index of database %s. error: %w", databaseID, err)
+	}
+
+	x.databases[databaseID] = index
+
+	return index, nil
+}
+
+// link returns the wikilink to the index note of the database.
+func (x *indexes) link(client client.NotionClient, databaseID string) (string, error) {
+	index, err := x.add(client, databaseID, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return pagePaths.link(databaseID, x.fileName(index)), nil
+}
+
+func (x *indexes) fileName(index *databaseIndex) string {
+	if x.format == indexBase {
+		return index.title() + ".base"
+	}
+	return index.title()
+}
+
+// write generates the index notes of every database recorded.
+func (x *indexes) write() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, index := range x.databases {
+		content := dataviewIndex(index)
+		if x.format == indexBase {
+			content = baseIndex(index)
+		}
+
+		if err := os.WriteFile(index.path, []byte(content), 0666); err != nil {
+			return fmt.Errorf("failed to write the index of database %s. error: %w", index.database.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *databaseIndex) title() string {
+	return sanitizeFileName(extractPlainTextFromRichText(d.database.Title))
+}
+
+// columns returns the name of the title property and the front matter keys
+// of the other exported properties, in the same order as the front matter.
+func (d *databaseIndex) columns() (string, []string) {
+	exportProps := len(d.include) > 0 || len(d.skip) > 0 || frontMatterMapping != nil
+	titleName := "Name"
+	keys := []string{}
+	seen := map[string]bool{}
+
+	for name, property := range d.database.Properties {
+		if property.Type == notion.DBPropTypeTitle {
+			titleName = name
+			continue
+		}
+		if !exportProps {
+			continue
+		}
+		if len(d.include) > 0 && !d.include[strings.ToLower(name)] {
+			continue
+		}
+		if d.skip[strings.ToLower(name)] {
+			continue
+		}
+
+		key := name
+		if frontMatterMapping != nil {
+			var ok bool
+			if key, ok = frontMatterMapping.key(name); !ok {
+				continue
+			}
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if frontMatterMapping != nil {
+		for key := range frontMatterMapping.Static {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return titleName, keys
+}
+
+func dataviewIndex(index *databaseIndex) string {
+	titleName, keys := index.columns()
+
+	columns := []string{fmt.Sprintf("file.link AS %s", dataviewString(titleName))}
+	for _, key := range keys {
+		if dataviewIdentifierRegex.MatchString(key) {
+			columns = append(columns, key)
+		} else {
+			columns = append(columns, fmt.Sprintf("row[%s] AS %s", dataviewString(key), dataviewString(key)))
+		}
+	}
+
+	b := &strings.Builder{}
+	if description := extractPlainTextFromRichText(index.database.Description); description != "" {
+		b.WriteString(description)
+		b.WriteString("\n\n")
+	}
+
+	// The pages link to the index through their front matter
+	b.WriteString("```dataview\n")
+	b.WriteString("TABLE WITHOUT ID " + strings.Join(columns, ", ") + "\n")
+	b.WriteString("FROM [[]]\n")
+	b.WriteString("WHERE " + databaseKey + "\n")
+	b.WriteString("SORT file.name ASC\n")
+	b.WriteString("```\n")
+
+	return b.String()
+}
+
+func dataviewString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func baseIndex(index *databaseIndex) string {
+	titleName, keys := index.columns()
+
+	b := &strings.Builder{}
+
+	// The pages link to the base through their front matter
+	b.WriteString("filters:\n")
+	b.WriteString("  and:\n")
+	b.WriteString("    - file.hasLink(this.file)\n")
+	b.WriteString("properties:\n")
+	b.WriteString("  file.name:\n")
+	b.WriteString("    displayName: " + yamlString(titleName) + "\n")
+	b.WriteString("views:\n")
+	b.WriteString("  - type: table\n")
+	b.WriteString("    name: " + yamlString(index.title()) + "\n")
+	b.WriteString("    order:\n")
+	b.WriteString("      - file.name\n")
+	for _, key := range keys {
+		b.WriteString("      - " + yamlString("note."+key) + "\n")
+	}
+	b.WriteString("    sort:\n")
+	b.WriteString("      - property: file.name\n")
+	b.WriteString("        direction: ASC\n")
+
+	return b.String()
+}
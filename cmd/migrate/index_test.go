@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func TestDatabaseIndex(t *testing.T) {
+	index := &databaseIndex{
+		database: notion.Database{
+			ID:    "habits",
+			Title: []notion.RichText{{PlainText: "Habits"}},
+			Properties: notion.DatabaseProperties{
+				"Name":     {Type: notion.DBPropTypeTitle},
+				"status":   {Type: notion.DBPropTypeSelect},
+				"Due date": {Type: notion.DBPropTypeDate},
+				"Internal": {Type: notion.DBPropTypeRichText},
+			},
+		},
+		skip: map[string]bool{"internal": true},
+	}
+
+	expected := "```dataview\n" +
+		"TABLE WITHOUT ID file.link AS \"Name\", row[\"Due date\"] AS \"Due date\", status\n" +
+		"FROM [[]]\n" +
+		"WHERE notion_database\n" +
+		"SORT file.name ASC\n" +
+		"```\n"
+
+	if result := dataviewIndex(index); result != expected {
+		t.Errorf("incorrect dataview index expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	expected = "filters:\n" +
+		"  and:\n" +
+		"    - file.hasLink(this.file)\n" +
+		"properties:\n" +
+		"  file.name:\n" +
+		"    displayName: Name\n" +
+		"views:\n" +
+		"  - type: table\n" +
+		"    name: Habits\n" +
+		"    order:\n" +
+		"      - file.name\n" +
+		"      - note.Due date\n" +
+		"      - note.status\n" +
+		"    sort:\n" +
+		"      - property: file.name\n" +
+		"        direction: ASC\n"
+
+	if result := baseIndex(index); result != expected {
+		t.Errorf("incorrect base index expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestIndexes_ReservePath(t *testing.T) {
+	paths := pagePaths
+	defer func() { pagePaths = paths }()
+
+	vault := t.TempDir()
+
+	// A page shares the title of its database
+	page := filepath.Join(vault, "Projects.md")
+	err := os.WriteFile(page, []byte("page"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &client.Fake{
+		Databases: map[string]notion.Database{
+			"projects": {ID: "projects", Title: []notion.RichText{{PlainText: "Projects"}}},
+			"tasks":    {ID: "tasks", Title: []notion.RichText{{PlainText: "Tasks"}}},
+		},
+	}
+
+	tests := []struct {
+		format   string
+		database string
+		link     string
+		file     string
+	}{
+		{indexDataview, "projects", "[[Projects projects|Projects]]", "Projects projects.md"},
+		{indexDataview, "tasks", "[[Tasks]]", "Tasks.md"},
+		{indexBase, "projects", "[[Projects.base]]", "Projects.base"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format+" "+test.database, func(t *testing.T) {
+			if pagePaths, err = newNotePaths(vault, collisionSuffix, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = pagePaths.assign("page", page); err != nil {
+				t.Fatal(err)
+			}
+
+			indexes, err := newIndexes(vault, test.format)
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+
+			link, err := indexes.link(fake, test.database)
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if link != test.link {
+				t.Errorf("incorrect link expected %s got: %s", test.link, link)
+			}
+
+			// Pages assigned later do not take the path of the index
+			other, err := pagePaths.assign("other", filepath.Join(vault, test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other == filepath.Join(vault, test.file) {
+				t.Errorf("incorrect path expected the index path to be reserved got: %s", other)
+			}
+
+			if err = indexes.write(); err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if _, err = os.Stat(filepath.Join(vault, test.file)); err != nil {
+				t.Errorf("expected the index written to %s got: %v", test.file, err)
+			}
+		})
+	}
+
+	content, err := os.ReadFile(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "page" {
+		t.Errorf("incorrect page expected it untouched by the index got: %s", content)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const journalFileName = ".notion_migrate_journal.jsonl"
+
+type jobStatus string
+
+const (
+	jobStatusPending jobStatus = "pending"
+	jobStatusDone    jobStatus = "done"
+	jobStatusFailed  jobStatus = "failed"
+)
+
+// journalEntry is a line of the journal. The journal is append only, the last
+// entry for a job is its current status.
+type journalEntry struct {
+	ID     string    `json:"id"`
+	Path   string    `json:"path"`
+	Status jobStatus `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	// LastEditedTime is the version of the page the job migrated
+	LastEditedTime time.Time `json:"last_edited_time"`
+}
+
+// journal records the status of every job on disk, so an interrupted
+// migration can be resumed without starting over.
+type journal struct {
+	entries map[string]journalEntry
+	path    string
+	file    *os.File
+	mu      sync.Mutex
+}
+
+// openJournal opens the journal stored in the vault. When resume is false any
+// previous journal is discarded.
+func openJournal(vault string, resume bool) (*journal, error) {
+	path := filepath.Join(vault, journalFileName)
+	j := &journal{
+		entries: map[string]journalEntry{},
+		path:    path,
+	}
+
+	if resume {
+		if err := j.load(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(vault, 0770); err != nil {
+		return nil, fmt.Errorf("failed to create the Obsidian vault directory. error: %w", err)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0660)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the job journal %s. error: %w", path, err)
+	}
+	j.file = f
+
+	return j, nil
+}
+
+func (j *journal) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open the job journal %s. error: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry journalEntry
+		// A crash can leave a partially written last line, we ignore it and
+		// the job is retried.
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		j.entries[entry.ID] = entry
+	}
+
+	return scanner.Err()
+}
+
+// done reports whether the job completed in a previous run, for the same
+// version of the page.
+func (j *journal) done(id string, lastEdited time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := j.entries[id]
+	return entry.Status == jobStatusDone && entry.LastEditedTime.Equal(lastEdited)
+}
+
+func (j *journal) record(job job, status jobStatus, jobErr error) error {
+	entry := journalEntry{
+		ID:             job.id,
+		Path:           job.path,
+		Status:         status,
+		LastEditedTime: job.lastEdited,
+	}
+	if jobErr != nil {
+		entry.Error = jobErr.Error()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries[entry.ID] = entry
+	if _, err = j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write to the job journal. error: %w", err)
+	}
+
+	return nil
+}
+
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// remove closes and deletes the journal once there is nothing to resume.
+func (j *journal) remove() error {
+	if err := j.close(); err != nil {
+		return fmt.Errorf("failed to close the job journal. error: %w", err)
+	}
+
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove the job journal %s. error: %w", j.path, err)
+	}
+
+	return nil
+}
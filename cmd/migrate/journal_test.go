@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func TestJournal_Resume(t *testing.T) {
+	vault := t.TempDir()
+	edited := time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC)
+
+	j, err := openJournal(vault, false)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	records := []struct {
+		id     string
+		status jobStatus
+		err    error
+	}{
+		{"done", jobStatusDone, nil},
+		{"failed", jobStatusPending, nil},
+		{"failed", jobStatusFailed, errors.New("timeout")},
+		{"pending", jobStatusPending, nil},
+	}
+	for _, record := range records {
+		if err = j.record(job{id: record.id, path: record.id + ".md", lastEdited: edited}, record.status, record.err); err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+	}
+	if err = j.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash can leave the last line partially written
+	f, err := os.OpenFile(filepath.Join(vault, journalFileName), os.O_APPEND|os.O_WRONLY, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"pending","status":"do`)
+	f.Close()
+
+	resumed, err := openJournal(vault, true)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	defer resumed.close()
+
+	tests := []struct {
+		name       string
+		id         string
+		lastEdited time.Time
+		expected   bool
+	}{
+		{"done", "done", edited, true},
+		{"edited since", "done", edited.Add(time.Minute), false},
+		{"failed", "failed", edited, false},
+		{"pending", "pending", edited, false},
+		{"unknown", "unknown", edited, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if done := resumed.done(test.id, test.lastEdited); done != test.expected {
+				t.Errorf("incorrect done expected %t got: %t", test.expected, done)
+			}
+		})
+	}
+
+	if entry := resumed.entries["failed"]; entry.Error != "timeout" {
+		t.Errorf("incorrect error expected timeout got: %q", entry.Error)
+	}
+
+	// Without -resume the previous journal is discarded
+	fresh, err := openJournal(vault, false)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	defer fresh.close()
+
+	if fresh.done("done", edited) {
+		t.Errorf("incorrect done expected false got: true")
+	}
+}
+
+func TestMigrationJobs_Resume(t *testing.T) {
+	vault, paths, resumed := *obsidianVault, pagePaths, *resume
+	defer func() { *obsidianVault, pagePaths, *resume = vault, paths, resumed }()
+
+	*obsidianVault = t.TempDir()
+	*resume = true
+
+	var err error
+	if pagePaths, err = newNotePaths(*obsidianVault, collisionSuffix, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC)
+	written := titledPage("written", notion.Parent{Type: notion.ParentTypeWorkspace}, "Written")
+	written.LastEditedTime = edited
+	interrupted := titledPage("interrupted", notion.Parent{Type: notion.ParentTypeWorkspace}, "Interrupted")
+	interrupted.LastEditedTime = edited
+
+	fake := &client.Fake{
+		Blocks: map[string][]notion.Block{
+			"written":     blocksFromJSON(t, "["+blockJSON("a", "paragraph", "first", false)+"]"),
+			"interrupted": blocksFromJSON(t, "["+blockJSON("b", "paragraph", "second", false)+"]"),
+		},
+	}
+
+	notePaths := map[string]string{}
+	for _, page := range []notion.Page{written, interrupted} {
+		if notePaths[page.ID], err = pagePaths.assign(page.ID, filepath.Join(*obsidianVault, pageTitle(page)+".md")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The previous run wrote the first page and crashed before saving the
+	// sync state
+	previous, err := openJournal(*obsidianVault, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = previous.record(job{id: "written", path: notePaths["written"], lastEdited: edited}, jobStatusDone, nil); err != nil {
+		t.Fatal(err)
+	}
+	previous.close()
+
+	state, err := loadSyncState(*obsidianVault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err := openJournal(*obsidianVault, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.close()
+
+	jobs, err := migrationJobs(fake, []notion.Page{written, interrupted}, notePaths, map[string]bool{}, map[string]bool{}, state, journal)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	if len(jobs) != 1 || jobs[0].id != "interrupted" {
+		t.Fatalf("incorrect jobs expected [interrupted] got: %v", jobs)
+	}
+
+	// The skipped page is recorded again so the next run sees it unchanged
+	if page, ok := state.Pages["written"]; !ok || page.Path != notePaths["written"] || !page.LastEditedTime.Equal(edited) {
+		t.Errorf("incorrect state for the skipped page got: %+v", page)
+	}
+
+	queue := newQueue("testing")
+	queue.addJobs(jobs)
+	if errorJobs := runWorkers(queue, journal, 2); len(errorJobs) != 0 {
+		t.Fatalf("incorrect failed jobs expected none got: %v", errorJobs)
+	}
+
+	if !journal.done("interrupted", edited) {
+		t.Errorf("incorrect journal expected the interrupted page done")
+	}
+	if _, ok := state.Pages["interrupted"]; !ok {
+		t.Errorf("incorrect state expected the interrupted page recorded")
+	}
+	if _, err = os.Stat(notePaths["interrupted"]); err != nil {
+		t.Errorf("expected the interrupted page written got: %v", err)
+	}
+
+	// A clean run removes the journal
+	if err = journal.remove(); err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(*obsidianVault, journalFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("incorrect journal expected removed got: %v", err)
+	}
+}
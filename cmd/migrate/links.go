@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+)
+
+const (
+	externalLinksWikilink = "wikilink"
+	externalLinksNotion   = "notion"
+)
+
+// pageLink returns the link from the note at notePath to the page. Pages
+// found by the discovery pass link to their note. Pages outside of the
+// migration link to a note named after them, or to Notion with
+// -external-links notion. The title is used when the page is not migrated,
+// when empty the page is fetched to find it.
+func pageLink(client client.NotionClient, notePath, pageID, title string) (string, error) {
+	if path, noteTitle, ok := pagePaths.target(pageID); ok {
+		return output.link(notePath, pageID, path, noteTitle), nil
+	}
+
+	target, ok := mentionCache.Get(pageID)
+	if !ok {
+		target = mentionTarget{url: notionURL(pageID)}
+		// The page is only fetched for its title, the links keep the text
+		// they are given
+		if title == "" {
+			page, err := client.FindPageByID(context.Background(), pageID)
+			// The integration might not have access to the page, which can
+			// still be opened in Notion
+			if err == nil {
+				target.title = pageTitle(page)
+				if page.URL != "" {
+					target.url = page.URL
+				}
+			}
+			mentionCache.Set(pageID, target)
+		}
+	}
+
+	if title == "" {
+		title = target.title
+	}
+	if title == "" {
+		return "<" + target.url + ">", nil
+	}
+
+	return output.externalLink(title, target.url), nil
+}
+
+// relationValue returns the front matter value for a related page, its link
+// when the format supports links in the front matter or its title otherwise.
+func relationValue(client client.NotionClient, notePath, pageID string) (string, error) {
+	if output.frontMatterLinks() {
+		return pageLink(client, notePath, pageID, "")
+	}
+
+	if _, title, ok := pagePaths.target(pageID); ok {
+		return title, nil
+	}
+
+	page, err := client.FindPageByID(context.Background(), pageID)
+	if err != nil {
+		return notionURL(pageID), nil
+	}
+
+	return pageTitle(page), nil
+}
+
+// notionURL returns the URL of the page in Notion.
+func notionURL(pageID string) string {
+	return "https://www.notion.so/" + strings.ReplaceAll(pageID, "-", "")
+}
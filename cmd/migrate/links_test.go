@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func TestPageLink(t *testing.T) {
+	paths, mentions, external := pagePaths, mentionCache, *externalLinks
+	defer func() { pagePaths, mentionCache, *externalLinks = paths, mentions, external }()
+
+	state := &syncState{Pages: map[string]pageState{
+		"unchanged": {LastEditedTime: time.Now(), Path: filepath.FromSlash("vault/Archive/Notes.md"), Title: "Notes"},
+		"renamed":   {LastEditedTime: time.Now(), Path: filepath.FromSlash("vault/Archive/Plan.md"), Title: "Plan"},
+	}}
+
+	var err error
+	if pagePaths, err = newNotePaths("vault", collisionSuffix, state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pagePaths.assign("migrated", filepath.FromSlash("vault/Meeting- 2023.md")); err != nil {
+		t.Fatal(err)
+	}
+	pagePaths.setTitle("migrated", "Meeting: 2023")
+	if _, err = pagePaths.assign("other-notes", filepath.FromSlash("vault/Projects/Notes.md")); err != nil {
+		t.Fatal(err)
+	}
+	pagePaths.setTitle("other-notes", "Notes")
+	if _, err = pagePaths.assign("renamed", filepath.FromSlash("vault/Archive/Plan 2024.md")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pagePaths.assign("plan", filepath.FromSlash("vault/Drafts/plan.md")); err != nil {
+		t.Fatal(err)
+	}
+	pagePaths.setTitle("plan", "plan")
+
+	fake := &client.Fake{
+		Pages: map[string]notion.Page{
+			"outside": titledPage("outside", notion.Parent{Type: notion.ParentTypeWorkspace}, "Roadmap [draft]"),
+		},
+	}
+
+	tests := []struct {
+		externalLinks string
+		pageID        string
+		title         string
+		expected      string
+	}{
+		{externalLinksWikilink, "migrated", "", "[[Meeting- 2023|Meeting: 2023]]"},
+		// Pages migrated on previous runs keep resolving to their note
+		{externalLinksWikilink, "unchanged", "", "[[Archive/Notes|Notes]]"},
+		// The name of a page moved on this run is free for other pages
+		{externalLinksWikilink, "plan", "", "[[plan]]"},
+		{externalLinksWikilink, "outside", "", "[[Roadmap draft]]"},
+		{externalLinksNotion, "outside", "", "[Roadmap \\[draft\\]](https://www.notion.so/outside)"},
+		{externalLinksNotion, "mentioned-1234", "Ideas", "[Ideas](https://www.notion.so/mentioned1234)"},
+		{externalLinksNotion, "private", "", "<https://www.notion.so/private>"},
+	}
+
+	for _, test := range tests {
+		mentionCache = newCache()
+		*externalLinks = test.externalLinks
+
+		link, err := pageLink(fake, "vault/note.md", test.pageID, test.title)
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+		if link != test.expected {
+			t.Errorf("incorrect link to %s expected %q got: %q", test.pageID, test.expected, link)
+		}
+	}
+}
+
+func TestPageLink_SamePageTwice(t *testing.T) {
+	mentions, external := mentionCache, *externalLinks
+	defer func() { mentionCache, *externalLinks = mentions, external }()
+	*externalLinks = externalLinksNotion
+
+	fake := &client.Fake{
+		Pages: map[string]notion.Page{
+			"outside": titledPage("outside", notion.Parent{Type: notion.ParentTypeWorkspace}, "Roadmap"),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		titles   []string
+		expected []string
+	}{
+		{"text link first", []string{"click here", ""}, []string{"[click here](https://www.notion.so/outside)", "[Roadmap](https://www.notion.so/outside)"}},
+		{"mention first", []string{"", "click here"}, []string{"[Roadmap](https://www.notion.so/outside)", "[click here](https://www.notion.so/outside)"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mentionCache = newCache()
+			for i, title := range test.titles {
+				link, err := pageLink(fake, "vault/note.md", "outside", title)
+				if err != nil {
+					t.Fatalf("expected nil got: %v", err)
+				}
+				if link != test.expected[i] {
+					t.Errorf("incorrect link expected %q got: %q", test.expected[i], link)
+				}
+			}
+		})
+	}
+}
@@ -14,57 +14,53 @@ import (
 	"sync"
 	"time"
 
+	"github.com/GustavoCaso/notion_workflows/pkg/auth"
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/GustavoCaso/notion_workflows/pkg/config"
 	"github.com/dstotijn/go-notion"
-	"github.com/itchyny/timefmt-go"
 	"github.com/schollz/progressbar/v3"
 )
 
+// mentionTarget is the title and URL of a page outside of the migration. The
+// title is empty when the integration has no access to the page.
+type mentionTarget struct {
+	title string
+	url   string
+}
+
 type cache struct {
-	storage map[string]string
-	working map[string]bool
+	storage map[string]mentionTarget
 	mu      sync.RWMutex
 }
 
-func (c *cache) Get(value string) (string, bool) {
+func (c *cache) Get(value string) (mentionTarget, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	val, ok := c.storage[value]
 	return val, ok
 }
 
-func (c *cache) Set(key, value string) {
+func (c *cache) Set(key string, value mentionTarget) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.storage[key] = value
-	c.working[key] = false
-}
-
-func (c *cache) Mark(key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.working[key] = true
-}
-
-func (c *cache) IsWorking(key string) bool {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.working[key]
 }
 
 func newCache() *cache {
-	storage := map[string]string{}
-	working := map[string]bool{}
 	return &cache{
-		storage: storage,
-		working: working,
+		storage: map[string]mentionTarget{},
 	}
 }
 
+// mentionCache holds the titles and URLs of the pages outside of the
+// migration.
 var mentionCache = newCache()
 
 type job struct {
-	path string
-	run  func() error
+	id         string
+	path       string
+	lastEdited time.Time
+	run        func() error
 }
 
 type errJob struct {
@@ -75,14 +71,14 @@ type errJob struct {
 type queue struct {
 	jobs        chan job
 	progressBar *progressbar.ProgressBar
-	wg          sync.WaitGroup
-	cancel      context.CancelFunc
-	ctx         context.Context
+	// pending counts the jobs added and not done yet, the queue is closed
+	// once there are none left
+	pending sync.WaitGroup
+	// mu guards the progress bar, its maximum changes while the jobs run
+	mu sync.Mutex
 }
 
 func newQueue(description string) *queue {
-	ctx, cancel := context.WithCancel(context.Background())
-
 	progressbar := progressbar.NewOptions(
 		0,
 		progressbar.OptionSetDescription(description),
@@ -101,83 +97,167 @@ func newQueue(description string) *queue {
 
 	return &queue{
 		jobs:        make(chan job),
-		ctx:         ctx,
-		cancel:      cancel,
 		progressBar: progressbar,
 	}
 }
 
+// addJobs feeds the jobs to the workers from a goroutine. Running jobs can
+// add more jobs, they keep the queue open until they are done.
 func (q *queue) addJobs(jobs []job) {
-	total := len(jobs)
-	q.wg.Add(total)
-	max := q.progressBar.GetMax()
-	q.progressBar.ChangeMax(max + total)
+	q.mu.Lock()
+	q.progressBar.ChangeMax(q.progressBar.GetMax() + len(jobs))
+	q.mu.Unlock()
 
-	for _, pageJob := range jobs {
-		go func(job job) {
-			q.jobs <- job
-			if q.progressBar != nil {
-				q.progressBar.Add(1)
-			}
-			q.wg.Done()
-		}(pageJob)
-	}
+	q.pending.Add(len(jobs))
 
 	go func() {
-		q.wg.Wait()
-		q.cancel()
+		for _, job := range jobs {
+			q.jobs <- job
+		}
 	}()
 }
 
+func (q *queue) advance() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.progressBar.Add(1)
+}
+
+// worker runs jobs from the queue until it is closed. Each worker keeps the
+// jobs that failed on it.
 type worker struct {
 	queue     *queue
+	journal   *journal
 	errorJobs []errJob
 }
 
-func (w *worker) doWork() bool {
-	for {
-		select {
-		case <-w.queue.ctx.Done():
-			fmt.Print("Finish migrating pages\n")
-			return true
-		case job := <-w.queue.jobs:
-			err := job.run()
-			if err != nil {
-				errJob := errJob{
-					job: job,
-					err: err,
-				}
-				w.errorJobs = append(w.errorJobs, errJob)
-				continue
+func (w *worker) doWork() {
+	for job := range w.queue.jobs {
+		err := job.run()
+		w.queue.advance()
+		if err != nil {
+			errJob := errJob{
+				job: job,
+				err: err,
 			}
+			w.errorJobs = append(w.errorJobs, errJob)
+			w.record(job, jobStatusFailed, err)
+		} else {
+			w.record(job, jobStatusDone, nil)
 		}
+		w.queue.pending.Done()
 	}
 }
 
-type pathAttributes map[string]string
+// runWorkers runs the jobs of the queue on concurrency workers until they are
+// all done, and returns the jobs that failed on any of them.
+func runWorkers(queue *queue, journal *journal, concurrency int) []errJob {
+	workers := make([]*worker, concurrency)
+	var wg sync.WaitGroup
+
+	go func() {
+		queue.pending.Wait()
+		close(queue.jobs)
+	}()
+
+	for i := range workers {
+		workers[i] = &worker{
+			queue:   queue,
+			journal: journal,
+		}
+
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.doWork()
+		}(workers[i])
+	}
+
+	wg.Wait()
+
+	errorJobs := []errJob{}
+	for _, w := range workers {
+		errorJobs = append(errorJobs, w.errorJobs...)
+	}
+
+	return errorJobs
+}
+
+func (w *worker) record(job job, status jobStatus, jobErr error) {
+	if w.journal == nil {
+		return
+	}
+	if err := w.journal.record(job, status, jobErr); err != nil {
+		fmt.Println(err)
+	}
+}
 
 var databaseIDUsage = `notion database ID to migrate.
 If you want to specify the propeties to convert to frontmater use a colon and provide a comma separated list. Ex ID:name,date
 If you rather want to provide a skip list separate the ID and the skip list using >. Ex ID>day of the week,date
+Both lists can be combined, the skip list goes last. Ex ID:name,date,tags>date
 `
 
-var token = flag.String("token", os.Getenv("NOTION_TOKEN"), "notion token")
+var tokenFlags = auth.RegisterFlags(flag.CommandLine)
+var profileFlags = config.RegisterFlags(flag.CommandLine)
 var databaseID = flag.String("id", os.Getenv("NOTION_DATABASE_ID"), databaseIDUsage)
+var mode = flag.String("mode", modeDatabase, "What to migrate: database (the pages of the -id database), page (the -id page and all the pages below it) or workspace (every page shared with the integration)")
 var obsidianVault = flag.String("vault", os.Getenv("OBSIDIAN_VAULT_PATH"), "Obsidian vault location")
-var pagePath = flag.String("path", "", "Page path in which to store the pages. Support selecting different page attribute and formatting")
+var pagePath = flag.String("path", "", `Page path in which to store the pages, within the vault. Defaults to the page title.
+Either a comma separated list of properties, with a strftime format for dates. Ex date:%Y-%m-%d,name
+Or a Go template over the properties. Ex {{.Date | date "%Y/%m"}}/{{.Name}}`)
+var collision = flag.String("collision", collisionSuffix, "What to do when two pages get the same path: suffix (add a short ID to the name), folder (nest in a folder named after a short ID) or fail")
+var attachmentsDir = flag.String("attachments", "attachments", "Folder within the Obsidian vault in which to store the files hosted by Notion")
+var attachmentLinks = flag.String("attachment-links", attachmentLinksWikilink, "How to link to the downloaded files: wikilink (![[embed]]), markdown (relative links) or static (links from the root of the site). Formats without wikilinks use markdown, and hugo uses static")
+var mappingPath = flag.String("mapping", "", "JSON file with the rules to rename, convert and add front matter keys")
+var resume = flag.Bool("resume", false, "Resume an interrupted migration, skipping the pages already migrated and retrying the failed ones")
+var indexFormat = flag.String("index", indexDataview, "Index note generated for each migrated database: dataview (a Dataview query), base (an Obsidian base) or none")
+var mirrorHierarchy = flag.Bool("hierarchy", false, "Mirror the Notion page tree, writing the sub pages of a page into a folder named after it")
+var folderNotes = flag.Bool("folder-notes", false, "With -hierarchy, write the pages with sub pages inside their folder as folder notes")
+var externalLinks = flag.String("external-links", externalLinksWikilink, "How to link to the pages outside of the migration: wikilink (a note named after the page) or notion (the URL of the page in Notion)")
+var childDatabases = flag.Bool("child-databases", false, "Also migrate the pages of the databases found within the migrated pages")
+var concurrency = flag.Int("concurrency", 4, "Number of pages migrated at the same time")
+var requestRate = flag.Float64("rate", 3, "Maximum number of requests per second sent to the Notion API, shared by all the workers")
+var format = flag.String("format", formatObsidian, "Markdown flavour of the notes: obsidian, logseq (outlines with key:: properties), hugo (content with relref links, the vault being the content folder), commonmark or html (a static site with an index and a search index)")
+var frontMatterFormat = flag.String("front-matter", frontMatterYAML, "Front matter written for -format hugo: yaml or toml")
+var fullSync = flag.Bool("full", false, "Migrate every page, ignoring the sync state stored in the vault from previous runs")
 
 func main() {
 	flag.Parse()
 
-	if empty(token) {
+	profile, err := profileFlags.Load()
+	if err != nil {
+		fmt.Printf("failed to load profile. error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if profile != nil {
+		if empty(databaseID) {
+			*databaseID = profile.Migrate.DatabaseID
+		}
+		if empty(obsidianVault) {
+			*obsidianVault = profile.Migrate.Vault
+		}
+	}
+
+	token, err := config.TokenSource(profile, tokenFlags, "NOTION_TOKEN").Token()
+	if err != nil {
 		flag.Usage()
-		fmt.Println("You must provide the notion token to run the script")
+		fmt.Printf("You must provide the notion token to run the script. error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if empty(databaseID) {
+	switch *mode {
+	case modeDatabase, modePage:
+		if empty(databaseID) {
+			flag.Usage()
+			fmt.Printf("You must provide the notion %s id to run the script\n", *mode)
+			os.Exit(1)
+		}
+	case modeWorkspace:
+	default:
 		flag.Usage()
-		fmt.Println("You must provide the notion database id to run the script")
+		fmt.Printf("unsupported mode %q. use %s, %s or %s\n", *mode, modeDatabase, modePage, modeWorkspace)
 		os.Exit(1)
 	}
 
@@ -185,27 +265,30 @@ func main() {
 	dbPropertiesSet := map[string]bool{}
 	dbPropertiesSkipSet := map[string]bool{}
 
-	results := strings.Split(databaseIDCopy, ":")
+	results := strings.SplitN(databaseIDCopy, ">", 2)
 	if len(results) > 1 {
-		dbProperties := strings.Split(results[1], ",")
-		for _, dbProp := range dbProperties {
-			dbPropertiesSet[strings.ToLower(dbProp)] = true
+		dbPropertiesToSkip := strings.Split(results[1], ",")
+		for _, dbProp := range dbPropertiesToSkip {
+			dbPropertiesSkipSet[strings.ToLower(dbProp)] = true
 		}
 	}
 
-	results = strings.Split(databaseIDCopy, ">")
+	results = strings.SplitN(results[0], ":", 2)
 	if len(results) > 1 {
-		dbPropertiesToSkip := strings.Split(results[1], ",")
-		for _, dbProp := range dbPropertiesToSkip {
-			dbPropertiesSkipSet[strings.ToLower(dbProp)] = true
+		dbProperties := strings.Split(results[1], ",")
+		for _, dbProp := range dbProperties {
+			dbPropertiesSet[strings.ToLower(dbProp)] = true
 		}
 	}
 
 	databaseID = &results[0]
 
-	if len(dbPropertiesSet) > 0 && len(dbPropertiesSkipSet) > 0 {
-		fmt.Println("You can not provide both skip list and include list for DB properties")
-		os.Exit(1)
+	if !empty(mappingPath) {
+		frontMatterMapping, err = loadPropertyMapping(*mappingPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 
 	if empty(obsidianVault) {
@@ -214,802 +297,843 @@ func main() {
 		os.Exit(1)
 	}
 
-	pagePathFilters := pathAttributes{}
-	if !empty(pagePath) {
-		pagePathResults := strings.Split(*pagePath, ",")
-		for _, pagePathAttribute := range pagePathResults {
-			pageWithFormatOptions := strings.Split(pagePathAttribute, ":")
-			if len(pageWithFormatOptions) > 1 {
-				pagePathFilters[strings.ToLower(pageWithFormatOptions[0])] = pageWithFormatOptions[1]
-			} else {
-				pagePathFilters[strings.ToLower(pageWithFormatOptions[0])] = ""
+	pathTemplate, err := parsePathTemplate(*pagePath)
+	if err != nil {
+		flag.Usage()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	output, err = newRenderer(*format, *frontMatterFormat)
+	if err != nil {
+		flag.Usage()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *format == formatHTML {
+		noteExtension = ".html"
+	}
+
+	attachmentsRoot, attachmentsFolder, links := *obsidianVault, *attachmentsDir, *attachmentLinks
+	switch *format {
+	case formatHugo:
+		// Hugo serves the files from the static folder next to the content
+		attachmentsRoot = filepath.Join(filepath.Dir(filepath.Clean(*obsidianVault)), "static")
+		links = attachmentLinksStatic
+	case formatLogseq, formatCommonMark, formatHTML:
+		if links == attachmentLinksWikilink {
+			links = attachmentLinksMarkdown
+		}
+	}
+
+	attachmentStore, err = newAttachments(attachmentsRoot, attachmentsFolder, links)
+	if err != nil {
+		flag.Usage()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// The indexes are Dataview queries and Obsidian bases
+	if *format == formatObsidian {
+		databaseIndexes, err = newIndexes(*obsidianVault, *indexFormat)
+		if err != nil {
+			flag.Usage()
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if *externalLinks != externalLinksWikilink && *externalLinks != externalLinksNotion {
+		flag.Usage()
+		fmt.Printf("unsupported external links %q. use %s or %s\n", *externalLinks, externalLinksWikilink, externalLinksNotion)
+		os.Exit(1)
+	}
+
+	if *concurrency < 1 || *requestRate <= 0 {
+		flag.Usage()
+		fmt.Println("The concurrency and the rate must be greater than zero")
+		os.Exit(1)
+	}
+
+	fetchSlots = make(chan struct{}, *concurrency)
+
+	client := client.NewClient(token, client.RateLimit(*requestRate))
+
+	state, err := loadSyncState(*obsidianVault)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	pagePaths, err = newNotePaths(*obsidianVault, *collision, state)
+	if err != nil {
+		flag.Usage()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *format == formatHTML {
+		if _, err = pagePaths.assign(siteIndexID, filepath.Join(*obsidianVault, siteIndexFile)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if *mirrorHierarchy {
+		hierarchy = &pageTree{folderNotes: *folderNotes}
+	}
+
+	// Notion rounds last_edited_time down to the minute, so we do the same with
+	// the sync start to not miss pages edited while the migration runs.
+	syncStart := time.Now().UTC().Truncate(time.Minute)
+
+	// The discovery pass finds every page to migrate and gives each one its
+	// path, so the render pass can link between them in any order
+	var pages []notion.Page
+
+	switch *mode {
+	case modeDatabase:
+		dbPages, err := fetchChangedDBPages(client, state)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// The pages of the database are placed with -path, their sub pages
+		// are placed next to them
+		for _, page := range dbPages {
+			path, err := filePath(page, pathTemplate)
+			if err == nil {
+				_, err = pagePaths.assign(page.ID, path)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		pages, err = discoverPages(client, dbPages, state)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if databaseIndexes != nil {
+			if _, err = databaseIndexes.add(client, *databaseID, dbPropertiesSet, dbPropertiesSkipSet); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
 			}
 		}
+	case modePage:
+		pages, err = discoverPageTree(client, *databaseID, state)
+	case modeWorkspace:
+		pages, err = discoverWorkspace(client)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	client := notion.NewClient(*token)
+	paths, err := assignPaths(client, pages, *databaseID)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	pages, _ := fetchNotionDBPages(client, *databaseID)
+	// The index notes take their path before any page is written
+	if databaseIndexes != nil {
+		for _, page := range pages {
+			if page.Parent.Type != notion.ParentTypeDatabase {
+				continue
+			}
+			include, skip := dbPropertiesSet, dbPropertiesSkipSet
+			if page.Parent.DatabaseID != *databaseID {
+				include, skip = map[string]bool{}, map[string]bool{}
+			}
+			if _, err = databaseIndexes.add(client, page.Parent.DatabaseID, include, skip); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+	}
 
-	var jobs []job
+	journal, err := openJournal(*obsidianVault, *resume)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer journal.close()
 
 	queue := newQueue("migrating notion pages")
 
+	jobs, err := migrationJobs(client, pages, paths, dbPropertiesSet, dbPropertiesSkipSet, state, journal)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if len(jobs) == 0 {
+		fmt.Println("No pages changed since the last migration")
+	}
+
+	for _, job := range jobs {
+		if err = journal.record(job, jobStatusPending, nil); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	// enequeue page to download and parse
+	queue.addJobs(jobs)
+
+	errorJobs := runWorkers(queue, journal, *concurrency)
+	fmt.Print("Finish migrating pages\n")
+
+	for _, errJob := range errorJobs {
+		fmt.Printf("an error ocurred when processing a page %s. error: %v\n", errJob.job.path, errors.Unwrap(errJob.err))
+	}
+
+	// Failed pages need to be queried again on the next run
+	if len(errorJobs) == 0 && *mode == modeDatabase {
+		state.setLastSync(*databaseID, syncStart)
+	}
+
+	if err = state.save(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// A clean run leaves nothing to resume
+	if len(errorJobs) == 0 {
+		if err = journal.remove(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if databaseIndexes != nil {
+		if err = databaseIndexes.write(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if *format == formatHTML {
+		if err = writeSite(client, siteTitle(client, pages), pages, dbPropertiesSet, dbPropertiesSkipSet); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+}
+
+// migrationJobs returns a job for every page to migrate. Pages unchanged
+// since the last run are skipped, and so are the pages done by the resumed
+// run, which are recorded in the sync state again in case it was not saved.
+func migrationJobs(client client.NotionClient, pages []notion.Page, paths map[string]string, dbPropertiesSet, dbPropertiesSkipSet map[string]bool, state *syncState, journal *journal) ([]job, error) {
+	var jobs []job
+
 	for _, page := range pages {
 		// We need to do this, because variables declared in for loops are passed by reference.
 		// Otherwise, our closure will always receive the last item from the page.
 		newPage := page
 
-		path := filePath(newPage, pagePathFilters)
+		path := paths[newPage.ID]
+		dbPage := newPage.Parent.Type == notion.ParentTypeDatabase
+
+		// The property lists of -id only apply to the pages of its database
+		include, skip := dbPropertiesSet, dbPropertiesSkipSet
+		if !dbPage || newPage.Parent.DatabaseID != *databaseID {
+			include, skip = map[string]bool{}, map[string]bool{}
+		}
+
+		unchanged := state.unchanged(newPage.ID, newPage.LastEditedTime, path)
+		if hierarchy != nil && hierarchy.folderNotes && !unchanged {
+			unchanged = state.unchanged(newPage.ID, newPage.LastEditedTime, folderNotePath(path))
+		}
+
+		// The trees fetched by the discovery pass are only kept for the pages
+		// rendered
+		if !*fullSync && unchanged {
+			blockTrees.take(newPage.ID)
+			continue
+		}
+
+		if *resume && journal.done(newPage.ID, newPage.LastEditedTime) {
+			blockTrees.take(newPage.ID)
+			if err := recordPage(state, newPage, path); err != nil {
+				return nil, err
+			}
+			continue
+		}
 
 		job := job{
-			path: path,
+			id:         newPage.ID,
+			path:       path,
+			lastEdited: newPage.LastEditedTime,
 			run: func() error {
-				return fetchAndSaveToObsidianVault(client, newPage, dbPropertiesSet, dbPropertiesSkipSet, path, true)
+				if err := fetchAndSaveToObsidianVault(client, newPage, include, skip, path, dbPage); err != nil {
+					return err
+				}
+
+				return recordPage(state, newPage, path)
 			},
 		}
 
 		jobs = append(jobs, job)
 	}
 
-	// enequeue page to download and parse
-	queue.addJobs(jobs)
+	return jobs, nil
+}
 
-	worker := worker{
-		queue: queue,
+// recordPage records the page written to path in the sync state. The page
+// title could have changed, so the file written on the previous run is removed.
+func recordPage(state *syncState, page notion.Page, path string) error {
+	// Pages can be moved into their folder as folder notes
+	if movedPath, ok := pagePaths.pathOf(page.ID); ok {
+		path = movedPath
 	}
 
-	worker.doWork()
-
-	for _, errJob := range worker.errorJobs {
-		fmt.Printf("an error ocurred when processing a page %s. error: %v\n", errJob.job.path, errors.Unwrap(errJob.err))
+	if previousPath := state.setPage(page.ID, page.LastEditedTime, path, pageTitle(page)); previousPath != "" {
+		if err := os.Remove(previousPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove previous file %s. error: %w", previousPath, err)
+		}
 	}
+
+	return nil
 }
 
 func empty(v *string) bool {
 	return *v == ""
 }
 
-func filePath(page notion.Page, pagePathProperties pathAttributes) string {
-	properties := page.Properties.(notion.DatabasePageProperties)
-	var str string
-
-	for key, value := range properties {
-		val, ok := pagePathProperties[strings.ToLower(key)]
-		if ok {
-			switch value.Type {
-			case notion.DBPropTypeDate:
-				date := value.Date.Start
-				if val != "" {
-					str += timefmt.Format(date.Time, val)
-				}
-			case notion.DBPropTypeTitle:
-				str += extractPlainTextFromRichText(value.Title)
-			default:
-				panic("not suported")
-			}
-		}
+// fetchChangedDBPages returns the pages of the database edited since the last
+// sync, or every page on the first run and with -full.
+func fetchChangedDBPages(c client.NotionClient, state *syncState) ([]notion.Page, error) {
+	var editedSince *time.Time
+	// The index of the site lists every page of the database
+	if lastSync, ok := state.lastSync(*databaseID); ok && !*fullSync && *format != formatHTML {
+		editedSince = &lastSync
 	}
 
-	fileName := fmt.Sprintf("%s.md", str)
-	return path.Join(*obsidianVault, fileName)
+	return fetchNotionDBPages(c, *databaseID, editedSince)
 }
 
-func fetchNotionDBPages(client *notion.Client, id string) ([]notion.Page, error) {
-	notionResponse, err := client.QueryDatabase(context.Background(), id, nil)
-	if err != nil {
-		panic(err)
-	}
-
-	result := []notion.Page{}
+func fetchNotionDBPages(c client.NotionClient, id string, editedSince *time.Time) ([]notion.Page, error) {
+	var filter *notion.DatabaseQueryFilter
 
-	result = append(result, notionResponse.Results...)
-
-	query := &notion.DatabaseQuery{}
-	for notionResponse.HasMore {
-		query.StartCursor = *notionResponse.NextCursor
-
-		notionResponse, err = client.QueryDatabase(context.Background(), id, query)
-		if err != nil {
-			panic(err)
+	if editedSince != nil {
+		filter = &notion.DatabaseQueryFilter{
+			Timestamp: notion.TimestampLastEditedTime,
+			DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+				LastEditedTime: &notion.DatePropertyFilter{
+					OnOrAfter: editedSince,
+				},
+			},
 		}
-
-		result = append(result, notionResponse.Results...)
 	}
 
-	return result, nil
+	return client.FindPages(context.Background(), c, id, filter)
 }
 
-func fetchAndSaveToObsidianVault(client *notion.Client, page notion.Page, pagePropertiesToInclude, pagePropertiesToSkip map[string]bool, obsidianPath string, dbPage bool) error {
-	pageBlocks, err := client.FindBlockChildrenByID(context.Background(), page.ID, nil)
-	if err != nil {
-		return fmt.Errorf("failed to extract children blocks for block ID %s. error: %w", page.ID, err)
+func fetchAndSaveToObsidianVault(client client.NotionClient, page notion.Page, pagePropertiesToInclude, pagePropertiesToSkip map[string]bool, obsidianPath string, dbPage bool) error {
+	var err error
+	nodes, ok := blockTrees.take(page.ID)
+	if !ok {
+		if nodes, err = fetchBlockTree(client, page.ID); err != nil {
+			return fmt.Errorf("failed to fetch the blocks of page %s. error: %w", page.ID, err)
+		}
 	}
 
-	if err := os.MkdirAll(filepath.Dir(obsidianPath), 0770); err != nil {
-		return fmt.Errorf("failed to create the necessary directories in for the Obsidian vault.  error: %w", err)
+	if hierarchy != nil {
+		obsidianPath = hierarchy.notePath(page.ID, obsidianPath, blocksOf(nodes))
 	}
 
-	f, err := os.Create(obsidianPath)
-	if err != nil {
-		return fmt.Errorf("failed to create the markdown file %s. error: %w", path.Base(obsidianPath), err)
+	if err := os.MkdirAll(filepath.Dir(obsidianPath), 0770); err != nil {
+		return fmt.Errorf("failed to create the necessary directories in for the Obsidian vault.  error: %w", err)
 	}
 
-	defer f.Close()
-
-	// create new buffer
-	buffer := bufio.NewWriter(f)
+	// The note is rendered in memory first since the table of contents
+	// needs every heading of the page
+	b := &bytes.Buffer{}
+	buffer := bufio.NewWriter(b)
 
+	frontMatter := false
 	if dbPage {
 		props := page.Properties.(notion.DatabasePageProperties)
 
 		selectedProps := make(notion.DatabasePageProperties)
 
-		if len(pagePropertiesToInclude) > 0 {
-			for propName, propValue := range props {
-				if pagePropertiesToInclude[strings.ToLower(propName)] {
-					selectedProps[propName] = propValue
-				}
+		for propName, propValue := range props {
+			if len(pagePropertiesToInclude) > 0 && !pagePropertiesToInclude[strings.ToLower(propName)] {
+				continue
 			}
+			if pagePropertiesToSkip[strings.ToLower(propName)] {
+				continue
+			}
+			selectedProps[propName] = propValue
 		}
 
-		if len(pagePropertiesToSkip) > 0 {
-			for propName, propValue := range props {
-				if !pagePropertiesToSkip[strings.ToLower(propName)] {
-					selectedProps[propName] = propValue
-				}
+		// Without include or skip lists the properties are only exported when
+		// there is a mapping for them, or to show them on the site
+		exportProps := len(pagePropertiesToInclude) > 0 || len(pagePropertiesToSkip) > 0 || frontMatterMapping != nil || *format == formatHTML
+		if !exportProps {
+			selectedProps = notion.DatabasePageProperties{}
+		}
+
+		if databaseIndexes != nil {
+			if _, err = databaseIndexes.add(client, page.Parent.DatabaseID, pagePropertiesToInclude, pagePropertiesToSkip); err != nil {
+				return err
 			}
 		}
-		if len(selectedProps) > 0 {
-			propertiesToFrontMatter(selectedProps, buffer)
+
+		// The front matter links the page to the index of its database
+		if len(selectedProps) > 0 || frontMatterMapping != nil || databaseIndexes != nil {
+			if err = propertiesToFrontMatter(client, page, selectedProps, buffer, obsidianPath); err != nil {
+				return fmt.Errorf("failed to write the front matter. error: %w", err)
+			}
+			frontMatter = true
 		}
 	}
 
-	err = pageToMarkdown(client, pageBlocks.Results, buffer, false)
+	// Some formats write a front matter for every page
+	if !frontMatter {
+		output.frontMatter(buffer, obsidianPath, page, nil)
+	}
+
+	err = output.writeBody(client, nodes, buffer, obsidianPath)
 
 	if err != nil {
 		return fmt.Errorf("failed to convert page to markdown. error: %w", err)
 	}
 
 	if err = buffer.Flush(); err != nil {
+		return fmt.Errorf("failed to render the markdown file %s. error: %w", path.Base(obsidianPath), err)
+	}
+
+	if err = os.WriteFile(obsidianPath, []byte(insertTableOfContents(b.String())), 0666); err != nil {
 		return fmt.Errorf("failed to write into the markdown file %s. error: %w", path.Base(obsidianPath), err)
 	}
 
 	return nil
 }
 
-func pageToMarkdown(client *notion.Client, blocks []notion.Block, buffer *bufio.Writer, indent bool) error {
+func pageToMarkdown(client client.NotionClient, nodes []*blockNode, buffer *bufio.Writer, notePath string, depth int) error {
 	var err error
+	prefix := indentation(depth)
+	// Consecutive numbered list items form a list. Any other block restarts
+	// the numbering. Nested lists are numbered on their own call.
+	listNumber := 0
+	// A line right after a quote, a callout or a table is read as part of
+	// it, so they are followed by an empty line.
+	endBlock := false
+
+	for i, node := range nodes {
+		object := node.block
+		separated := endBlock
+		if endBlock {
+			buffer.WriteString("\n")
+			endBlock = false
+		}
+
+		if _, ok := object.(*notion.NumberedListItemBlock); ok {
+			listNumber++
+		} else {
+			listNumber = 0
+		}
 
-	for _, object := range blocks {
 		switch block := object.(type) {
 		case *notion.Heading1Block:
-			if indent {
-				buffer.WriteString("	# ")
-			} else {
-				buffer.WriteString("# ")
-			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			if err = writeHeading(client, buffer, notePath, prefix, "# ", block.RichText); err != nil {
 				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			// Toggle headings hold their content as children, which belongs
+			// under the heading rather than nested in it.
+			if err = writeChrildren(client, node, buffer, notePath, depth); err != nil {
 				return err
 			}
 		case *notion.Heading2Block:
-			if indent {
-				buffer.WriteString("	## ")
-			} else {
-				buffer.WriteString("## ")
-			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			if err = writeHeading(client, buffer, notePath, prefix, "## ", block.RichText); err != nil {
 				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeChrildren(client, node, buffer, notePath, depth); err != nil {
 				return err
 			}
 		case *notion.Heading3Block:
-			if indent {
-				buffer.WriteString("	### ")
-			} else {
-				buffer.WriteString("### ")
-			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			if err = writeHeading(client, buffer, notePath, prefix, "### ", block.RichText); err != nil {
 				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeChrildren(client, node, buffer, notePath, depth); err != nil {
 				return err
 			}
 		case *notion.ToDoBlock:
-			if indent {
-				if *block.Checked {
-					buffer.WriteString("	- [x] ")
-				} else {
-					buffer.WriteString("	- [ ] ")
-				}
-			} else {
-				if *block.Checked {
-					buffer.WriteString("- [x] ")
-				} else {
-					buffer.WriteString("- [ ] ")
-				}
+			marker := "- [ ] "
+			if block.Checked != nil && *block.Checked {
+				marker = "- [x] "
 			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			if err = writeBlockText(client, buffer, notePath, prefix+marker, prefix+"\t", block.RichText); err != nil {
 				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeChrildren(client, node, buffer, notePath, depth+1); err != nil {
 				return err
 			}
 		case *notion.ParagraphBlock:
-			if len(block.RichText) > 0 {
-				if indent {
-					buffer.WriteString("	")
-					if err = writeRichText(client, buffer, block.RichText); err != nil {
-						return err
-					}
-				} else {
-					if err = writeRichText(client, buffer, block.RichText); err != nil {
-						return err
-					}
-				}
+			if err = writeBlockText(client, buffer, notePath, prefix, prefix, block.RichText); err != nil {
+				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeChrildren(client, node, buffer, notePath, depth+1); err != nil {
 				return err
 			}
 		case *notion.BulletedListItemBlock:
-			if indent {
-				buffer.WriteString("	- ")
-			} else {
-				buffer.WriteString("- ")
-			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			if err = writeBlockText(client, buffer, notePath, prefix+"- ", prefix+"\t", block.RichText); err != nil {
 				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeChrildren(client, node, buffer, notePath, depth+1); err != nil {
 				return err
 			}
 		case *notion.NumberedListItemBlock:
-			if indent {
-				buffer.WriteString("	- ")
-			} else {
-				buffer.WriteString("- ")
-			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			if err = writeBlockText(client, buffer, notePath, fmt.Sprintf("%s%d. ", prefix, listNumber), prefix+"\t", block.RichText); err != nil {
 				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeChrildren(client, node, buffer, notePath, depth+1); err != nil {
 				return err
 			}
 		case *notion.CalloutBlock:
-			if indent {
-				buffer.WriteString("	> [!")
-			} else {
-				buffer.WriteString("> [!")
-			}
-			if len(*block.Icon.Emoji) > 0 {
-				buffer.WriteString(*block.Icon.Emoji)
+			if err = writeCallout(client, buffer, notePath, prefix, calloutType(block.Icon), false, block.RichText); err != nil {
+				return err
 			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			if err = writeQuotedChildren(client, node, buffer, notePath, prefix); err != nil {
 				return err
 			}
-			buffer.WriteString("]")
-			buffer.WriteString("\n")
+			endBlock = true
 		case *notion.ToggleBlock:
-			if indent {
-				buffer.WriteString("	- ")
-			} else {
-				buffer.WriteString("- ")
-			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			// Toggles become callouts folded by default
+			if err = writeCallout(client, buffer, notePath, prefix, "note", true, block.RichText); err != nil {
 				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeQuotedChildren(client, node, buffer, notePath, prefix); err != nil {
 				return err
 			}
+			endBlock = true
 		case *notion.QuoteBlock:
-			if indent {
-				buffer.WriteString("	> ")
-			} else {
-				buffer.WriteString("> ")
-			}
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
+			if err = writeBlockText(client, buffer, notePath, prefix+"> ", prefix+"> ", block.RichText); err != nil {
 				return err
 			}
-			buffer.WriteString("\n")
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeQuotedChildren(client, node, buffer, notePath, prefix); err != nil {
 				return err
 			}
+			endBlock = true
 		case *notion.FileBlock:
-			if block.Type == notion.FileTypeExternal {
-				if indent {
-					buffer.WriteString(fmt.Sprintf("	![](%s)", block.External.URL))
-				} else {
-					buffer.WriteString(fmt.Sprintf("![](%s)", block.External.URL))
-				}
+			if err = writeFileBlock(buffer, notePath, prefix, block.Type, block.File, block.External, block.Caption, false); err != nil {
+				return err
 			}
-			buffer.WriteString("\n")
 		case *notion.DividerBlock:
+			buffer.WriteString(prefix)
 			buffer.WriteString("---")
 			buffer.WriteString("\n")
 		case *notion.ChildPageBlock:
-			if indent {
-				buffer.WriteString(fmt.Sprintf(" [[%s]]", block.Title))
-			} else {
-				buffer.WriteString(fmt.Sprintf("[[%s]]", block.Title))
+			// The block ID is the ID of the sub page
+			link, err := pageLink(client, notePath, block.ID(), block.Title)
+			if err != nil {
+				return err
 			}
+			buffer.WriteString(prefix)
+			buffer.WriteString(link)
 			buffer.WriteString("\n")
 		case *notion.LinkToPageBlock:
-			err := findOrFetchPage(client, block.PageID, buffer)
+			link, err := pageLink(client, notePath, block.PageID, "")
 			if err != nil {
 				return err
 			}
+			buffer.WriteString(prefix)
+			buffer.WriteString(link)
 			buffer.WriteString("\n")
 		case *notion.CodeBlock:
+			buffer.WriteString(prefix)
 			buffer.WriteString("```")
-			buffer.WriteString(*block.Language)
-			buffer.WriteString("\n")
-			if err = writeRichText(client, buffer, block.RichText); err != nil {
-				return err
+			if block.Language != nil {
+				buffer.WriteString(*block.Language)
 			}
 			buffer.WriteString("\n")
+			// Code is written verbatim, only indented to stay within its parent block
+			for _, line := range strings.Split(extractPlainTextFromRichText(block.RichText), "\n") {
+				buffer.WriteString(prefix)
+				buffer.WriteString(line)
+				buffer.WriteString("\n")
+			}
+			buffer.WriteString(prefix)
 			buffer.WriteString("```")
 			buffer.WriteString("\n")
 		case *notion.ImageBlock:
-			if block.Type == notion.FileTypeExternal {
-				if indent {
-					buffer.WriteString(fmt.Sprintf("	![](%s)", block.External.URL))
-				} else {
-					buffer.WriteString(fmt.Sprintf("![](%s)", block.External.URL))
-				}
-			}
-			if block.Type == notion.FileTypeFile {
-				if indent {
-					buffer.WriteString(fmt.Sprintf("	![](%s)", block.File.URL))
-				} else {
-					buffer.WriteString(fmt.Sprintf("![](%s)", block.File.URL))
-				}
+			if err = writeFileBlock(buffer, notePath, prefix, block.Type, block.File, block.External, block.Caption, true); err != nil {
+				return err
 			}
-			buffer.WriteString("\n")
 		case *notion.VideoBlock:
-			if block.Type == notion.FileTypeExternal {
-				if indent {
-					buffer.WriteString(fmt.Sprintf("	![](%s)", block.External.URL))
-				} else {
-					buffer.WriteString(fmt.Sprintf("![](%s)", block.External.URL))
-				}
+			if err = writeFileBlock(buffer, notePath, prefix, block.Type, block.File, block.External, block.Caption, true); err != nil {
+				return err
 			}
-			buffer.WriteString("\n")
-		case *notion.EmbedBlock:
-			if indent {
-				buffer.WriteString(fmt.Sprintf("	![](%s)", block.URL))
-			} else {
-				buffer.WriteString(fmt.Sprintf("![](%s)", block.URL))
+		case *notion.AudioBlock:
+			if err = writeFileBlock(buffer, notePath, prefix, block.Type, block.File, block.External, block.Caption, true); err != nil {
+				return err
 			}
+		case *notion.PDFBlock:
+			if err = writeFileBlock(buffer, notePath, prefix, block.Type, block.File, block.External, block.Caption, true); err != nil {
+				return err
+			}
+		case *notion.EmbedBlock:
+			buffer.WriteString(prefix)
+			buffer.WriteString(fmt.Sprintf("![](%s)", block.URL))
 			buffer.WriteString("\n")
 		case *notion.BookmarkBlock:
-			if indent {
-				buffer.WriteString(fmt.Sprintf("	![](%s)", block.URL))
-			} else {
-				buffer.WriteString(fmt.Sprintf("![](%s)", block.URL))
-			}
+			buffer.WriteString(prefix)
+			buffer.WriteString(fmt.Sprintf("![](%s)", block.URL))
 			buffer.WriteString("\n")
 		case *notion.ChildDatabaseBlock:
-			if indent {
-				buffer.WriteString(fmt.Sprintf("	%s", block.Title))
-			} else {
-				buffer.WriteString(block.Title)
+			title := block.Title
+			if databaseIndexes != nil {
+				if title, err = databaseIndexes.link(client, block.ID()); err != nil {
+					return err
+				}
 			}
+			buffer.WriteString(prefix)
+			buffer.WriteString(title)
 			buffer.WriteString("\n")
 		case *notion.ColumnListBlock:
-			if err = writeChrildren(client, object, buffer); err != nil {
+			// Columns have no markdown equivalent, their content is written
+			// one after the other at the same depth.
+			if err = writeChrildren(client, node, buffer, notePath, depth); err != nil {
 				return err
 			}
 		case *notion.ColumnBlock:
-			if err = writeChrildren(client, object, buffer); err != nil {
+			if err = writeChrildren(client, node, buffer, notePath, depth); err != nil {
 				return err
 			}
 		case *notion.TableBlock:
-			if err = writeTable(client, block.TableWidth, object, buffer); err != nil {
+			// Tables can not interrupt a paragraph or a list item
+			if (i > 0 || depth > 0) && !separated {
+				buffer.WriteString("\n")
+			}
+			if err = writeTable(client, block, node.children, buffer, notePath, prefix); err != nil {
 				return err
 			}
+			endBlock = true
 		case *notion.EquationBlock:
-			if indent {
-				buffer.WriteString(fmt.Sprintf(" $$%s$$", block.Expression))
-			} else {
-				buffer.WriteString(fmt.Sprintf("$$%s$$", block.Expression))
+			for _, line := range strings.Split(output.equation(block.Expression, true), "\n") {
+				buffer.WriteString(prefix)
+				buffer.WriteString(line)
+				buffer.WriteString("\n")
+			}
+		case *notion.SyncedBlock:
+			if err = writeSyncedBlock(client, block, node, buffer, notePath, depth); err != nil {
+				return err
 			}
+			// The placeholders are quotes
+			endBlock = node.unavailable
+		case *notion.TemplateBlock:
+			// Templates hold the content duplicated when clicking the button
+			if err = writeCallout(client, buffer, notePath, prefix, "example", true, block.RichText); err != nil {
+				return err
+			}
+			if err = writeQuotedChildren(client, node, buffer, notePath, prefix); err != nil {
+				return err
+			}
+			endBlock = true
+		case *notion.LinkPreviewBlock:
+			buffer.WriteString(prefix)
+			buffer.WriteString(block.URL)
+			buffer.WriteString("\n")
+		case *notion.BreadcrumbBlock:
+			if err = writeBreadcrumb(client, object, buffer, prefix); err != nil {
+				return err
+			}
+			// Breadcrumbs outside of pages are left as a placeholder
+			endBlock = object.Parent().Type != notion.ParentTypePage
+		case *notion.TableOfContentsBlock:
+			buffer.WriteString(prefix)
+			buffer.WriteString(tocMarker)
 			buffer.WriteString("\n")
-		case *notion.UnsupportedBlock:
 		default:
-			return fmt.Errorf("block not supported: %+v", block)
+			// Unknown blocks should not prevent migrating the rest of the page
+			writePlaceholder(buffer, prefix, fmt.Sprintf("Unsupported block: %s", blockType(object)))
+			endBlock = true
 		}
 	}
 
 	return nil
 }
 
-func propertiesToFrontMatter(propertites notion.DatabasePageProperties, buffer *bufio.Writer) {
-	buffer.WriteString("---\n")
-	for key, value := range propertites {
-		switch value.Type {
-		case notion.DBPropTypeTitle:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, extractPlainTextFromRichText(value.Title)))
-		case notion.DBPropTypeRichText:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, extractPlainTextFromRichText(value.RichText)))
-		case notion.DBPropTypeNumber:
-			buffer.WriteString(fmt.Sprintf("%s: %f\n", key, *value.Number))
-		case notion.DBPropTypeSelect:
-			if value.Select != nil {
-				buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.Select.Name))
-			}
-		case notion.DBPropTypeMultiSelect:
-			options := []string{}
-			for _, option := range value.MultiSelect {
-				options = append(options, option.Name)
-			}
-
-			buffer.WriteString(fmt.Sprintf("%s: [%s]\n", key, strings.Join(options[:], ",")))
-		case notion.DBPropTypeDate:
-			if value.Date != nil {
-				if value.Date.Start.HasTime() {
-					buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.Date.Start.Format("2006-01-02T15:04:05")))
-				} else {
-					buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.Date.Start.Format("2006-01-02")))
-				}
-			}
-		case notion.DBPropTypePeople:
-		case notion.DBPropTypeFiles:
-		case notion.DBPropTypeCheckbox:
-			buffer.WriteString(fmt.Sprintf("%s: %t\n", key, *value.Checkbox))
-		case notion.DBPropTypeURL:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, *value.URL))
-		case notion.DBPropTypeEmail:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, *value.Email))
-		case notion.DBPropTypePhoneNumber:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, *value.PhoneNumber))
-		case notion.DBPropTypeStatus:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.Status.Name))
-		case notion.DBPropTypeFormula:
-		case notion.DBPropTypeRelation:
-		case notion.DBPropTypeRollup:
-			switch value.Rollup.Type {
-			case notion.RollupResultTypeNumber:
-				buffer.WriteString(fmt.Sprintf("%s: %f\n", key, *value.Rollup.Number))
-			case notion.RollupResultTypeDate:
-				if value.Rollup.Date.Start.HasTime() {
-					buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.Rollup.Date.Start.Format("2006-01-02T15:04:05")))
-				} else {
-					buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.Rollup.Date.Start.Format("2006-01-02")))
-				}
-			}
-		case notion.DBPropTypeCreatedTime:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.CreatedTime.String()))
-		case notion.DBPropTypeCreatedBy:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.CreatedBy.Name))
-		case notion.DBPropTypeLastEditedTime:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.LastEditedTime.String()))
-		case notion.DBPropTypeLastEditedBy:
-			buffer.WriteString(fmt.Sprintf("%s: %s\n", key, value.LastEditedBy.Name))
-		default:
-		}
-	}
-	buffer.WriteString("---\n")
+// indentation returns the prefix for blocks nested depth levels deep.
+func indentation(depth int) string {
+	return strings.Repeat("\t", depth)
 }
 
-func writeChrildren(client *notion.Client, block notion.Block, buffer *bufio.Writer) error {
-	if block.HasChildren() {
-		pageBlocks, err := client.FindBlockChildrenByID(context.Background(), block.ID(), nil)
-		if err != nil {
-			return fmt.Errorf("failed to extract children blocks for block ID %s. error: %w", block.ID(), err)
-		}
-		return pageToMarkdown(client, pageBlocks.Results, buffer, true)
+func writeHeading(client client.NotionClient, buffer *bufio.Writer, notePath, prefix, marker string, richText []notion.RichText) error {
+	text, err := richTextToString(client, notePath, richText)
+	if err != nil {
+		return err
 	}
 
+	// Headings can only span a single line
+	buffer.WriteString(prefix)
+	buffer.WriteString(marker)
+	buffer.WriteString(strings.ReplaceAll(text, "\n", " "))
+	buffer.WriteString("\n")
+
 	return nil
 }
 
-type richText struct {
-	hasAnnotations    bool
-	notionAnnotations *notion.Annotations
-	stringAnnotation  string
-	text              string
-}
-
-// TODO: Handle annotations better
-func writeRichText(client *notion.Client, buffer *bufio.Writer, richTextBlock []notion.RichText) error {
-	richTexts := []richText{}
-
-	for _, text := range richTextBlock {
-		var annotation string
-		r := richText{}
-		b := &bytes.Buffer{}
-		richTextBuffer := bufio.NewWriter(b)
-		r.notionAnnotations = text.Annotations
-
-		if hasAnnotation(text.Annotations) {
-			r.hasAnnotations = true
-			annotation = annotationsToStyle(text.Annotations)
-			r.stringAnnotation = annotation
-		}
-
-		richTextBuffer.WriteString(annotation)
-
-		switch text.Type {
-		case notion.RichTextTypeText:
-			link := text.Text.Link
-			if link != nil && !strings.Contains(annotation, "`") {
-				if strings.HasPrefix(link.URL, "/") {
-					// Link to internal Notion page
-					err := findOrFetchPage(client, strings.TrimPrefix(link.URL, "/"), richTextBuffer)
-					if err != nil {
-						return err
-					}
-				} else {
-					richTextBuffer.WriteString(fmt.Sprintf("[%s](%s)", text.Text.Content, link.URL))
-				}
-			} else {
-				richTextBuffer.WriteString(text.Text.Content)
-			}
-		case notion.RichTextTypeMention:
-			switch text.Mention.Type {
-			case notion.MentionTypePage:
-				err := findOrFetchPage(client, text.Mention.Page.ID, richTextBuffer)
-				if err != nil {
-					return err
-				}
-			case notion.MentionTypeDatabase:
-				value := "[[" + text.PlainText + "]]"
-				richTextBuffer.WriteString(value)
-			case notion.MentionTypeDate:
-				value := "[[" + text.Mention.Date.Start.Format("2006-01-02") + "]]"
-				richTextBuffer.WriteString(value)
-			case notion.MentionTypeLinkPreview:
-				richTextBuffer.WriteString(text.Mention.LinkPreview.URL)
-			case notion.MentionTypeTemplateMention:
-			case notion.MentionTypeUser:
-			}
-		case notion.RichTextTypeEquation:
-			richTextBuffer.WriteString(fmt.Sprintf("$$%s$$", text.Equation.Expression))
-		}
-
-		richTextBuffer.WriteString(reverseString(annotation))
+// writeBlockText writes the rich text of a block. The first line starts with
+// firstPrefix, the following lines with linePrefix so a multi line block
+// stays within its parent.
+func writeBlockText(client client.NotionClient, buffer *bufio.Writer, notePath, firstPrefix, linePrefix string, richText []notion.RichText) error {
+	text, err := richTextToString(client, notePath, richText)
+	if err != nil {
+		return err
+	}
 
-		err := richTextBuffer.Flush()
-		if err != nil {
-			return err
-		}
-		r.text = b.String()
-		richTexts = append(richTexts, r)
-	}
-
-	var result string
-	for i, richText := range richTexts {
-		if i > 0 {
-			if richText.hasAnnotations && richTexts[i-1].hasAnnotations {
-				// There is a corner case for nested annotation of bold and italic
-				// https://help.obsidian.md/Editing+and+formatting/Basic+formatting+syntax#Bold%2C+italics%2C+highlights
-				// We only account for the easy case for now
-				if (richTexts[i-1].notionAnnotations.Bold && !richTexts[i-1].notionAnnotations.Italic) && (richText.notionAnnotations.Bold && richText.notionAnnotations.Italic) {
-					result = strings.TrimRight(result, "*")
-					text := richText.text
-					text = strings.TrimLeft(text, "*")
-					text = strings.TrimRight(text, "*")
-					text = "_" + text + "_**"
-					result += text
-				} else {
-					leftAnnotations := richTexts[i-1].stringAnnotation
-					rightAnnotations := richText.stringAnnotation
-					result = strings.TrimRight(result, reverseString(rightAnnotations))
-					test := strings.TrimLeft(richText.text, leftAnnotations)
-					result += test
-				}
-			} else {
-				result += richText.text
-			}
-		} else {
-			result += richText.text
-		}
+	if text == "" {
+		// Keep empty paragraphs as blank lines without trailing whitespace
+		buffer.WriteString(strings.TrimRight(firstPrefix, " \t"))
+		buffer.WriteString("\n")
+		return nil
 	}
 
-	buffer.WriteString(result)
+	buffer.WriteString(firstPrefix)
+	buffer.WriteString(strings.ReplaceAll(text, "\n", "\n"+linePrefix))
+	buffer.WriteString("\n")
 
 	return nil
 }
 
-func findOrFetchPage(client *notion.Client, pageID string, buffer *bufio.Writer) error {
-	val, ok := mentionCache.Get(pageID)
-	if ok {
-		buffer.WriteString(val)
-	} else {
-		// There could be pages that self reference them
-		// We need a way to mark that a page is being work on
-		// to avid endless loop
-		if mentionCache.IsWorking(pageID) {
-			return nil
-		}
-		mentionCache.Mark(pageID)
-		var pageMention string
-		defer mentionCache.Set(pageID, pageMention)
-
-		mentionPage, err := client.FindPageByID(context.Background(), pageID)
-		if err != nil {
-			// TODO: figure out why we hit this error
-			fmt.Printf("failed to find page %s. error %s\n", pageID, err.Error())
-			return nil
-		}
-
-		emptyList := map[string]bool{}
-		var childTitle string
-		switch mentionPage.Parent.Type {
-		case notion.ParentTypeDatabase:
-			props := mentionPage.Properties.(notion.DatabasePageProperties)
-			childTitle = extractPlainTextFromRichText(props["Name"].Title)
-
-			var childPath string
-			// Since we are migrating from the same DB we do need to create a subfolder
-			// within the Obsidian vault. So we can skip fetching the database to gather
-			// the name to create the subfolder
-			if *databaseID != mentionPage.Parent.DatabaseID {
-				dbPage, err := client.FindDatabaseByID(context.Background(), mentionPage.Parent.DatabaseID)
-				if err != nil {
-					return fmt.Errorf("failed to find parent db %s.  error: %w", mentionPage.Parent.DatabaseID, err)
-				}
-
-				dbTitle := extractPlainTextFromRichText(dbPage.Title)
+// calloutTypes maps the callout emoji to the closest Obsidian callout type.
+var calloutTypes = map[string]string{
+	"💡": "tip",
+	"🔥": "tip",
+	"⚠": "warning",
+	"🚧": "warning",
+	"❗": "important",
+	"📌": "important",
+	"ℹ": "info",
+	"📝": "note",
+	"✏": "note",
+	"❓": "question",
+	"🤔": "question",
+	"✅": "success",
+	"✔": "success",
+	"❌": "failure",
+	"🚫": "danger",
+	"⛔": "danger",
+	"🐛": "bug",
+	"📖": "example",
+	"💬": "quote",
+	"🗒": "abstract",
+	"📋": "todo",
+}
 
-				childPath = path.Join(dbTitle, fmt.Sprintf("%s.md", childTitle))
-			} else {
-				childPath = fmt.Sprintf("%s.md", childTitle)
-			}
+func calloutType(icon *notion.Icon) string {
+	if icon == nil || icon.Emoji == nil {
+		return "note"
+	}
 
-			if err = fetchAndSaveToObsidianVault(client, mentionPage, emptyList, emptyList, path.Join(*obsidianVault, childPath), true); err != nil {
-				return fmt.Errorf("failed to fetch and save mention page %s content with DB %s. error: %w", childTitle, mentionPage.Parent.DatabaseID, err)
-			}
-		case notion.ParentTypeBlock:
-			parentPage, err := client.FindPageByID(context.Background(), mentionPage.Parent.BlockID)
-			if err != nil {
-				return fmt.Errorf("failed to find parent block %s.  error: %w", mentionPage.Parent.BlockID, err)
-			}
-			var title []notion.RichText
+	// Drop the variation selector so ⚠️ and ⚠ are the same emoji
+	emoji := strings.ReplaceAll(*icon.Emoji, "\uFE0F", "")
+	if calloutType, ok := calloutTypes[emoji]; ok {
+		return calloutType
+	}
 
-			if parentPage.Parent.Type == notion.ParentTypeDatabase {
-				props := parentPage.Properties.(notion.DatabasePageProperties)
-				for _, val := range props {
-					if val.Type == notion.DBPropTypeTitle {
-						title = val.Title
-						break
-					}
-				}
-			} else {
-				props := parentPage.Properties.(notion.PageProperties)
-				title = props.Title.Title
-			}
+	return "note"
+}
 
-			childTitle = extractPlainTextFromRichText(title)
+// writeCallout writes the first line of the rich text as the callout title
+// and the rest as its content. Folded callouts are collapsed when reading.
+func writeCallout(client client.NotionClient, buffer *bufio.Writer, notePath, prefix, kind string, folded bool, richText []notion.RichText) error {
+	text, err := richTextToString(client, notePath, richText)
+	if err != nil {
+		return err
+	}
 
-			if err = fetchAndSaveToObsidianVault(client, mentionPage, emptyList, emptyList, path.Join(*obsidianVault, childTitle), false); err != nil {
-				return fmt.Errorf("failed to fetch and save mention page %s content with block parent %s. error: %w", childTitle, mentionPage.Parent.BlockID, err)
-			}
-		case notion.ParentTypePage:
-			parentPage, err := client.FindPageByID(context.Background(), mentionPage.Parent.PageID)
-			if err != nil {
-				return fmt.Errorf("failed to find parent mention page %s.  error: %w", mentionPage.Parent.PageID, err)
-			}
+	lines := strings.Split(text, "\n")
 
-			var title []notion.RichText
+	if title := strings.TrimRight(output.callout(kind, lines[0], folded), " "); title != "" {
+		buffer.WriteString(prefix)
+		buffer.WriteString(title)
+		buffer.WriteString("\n")
+	}
+	writeQuotedLines(buffer, prefix, lines[1:])
 
-			if parentPage.Parent.Type == notion.ParentTypeDatabase {
-				props := parentPage.Properties.(notion.DatabasePageProperties)
-				for _, val := range props {
-					if val.Type == notion.DBPropTypeTitle {
-						title = val.Title
-						break
-					}
-				}
-			} else {
-				props := parentPage.Properties.(notion.PageProperties)
-				title = props.Title.Title
-			}
+	return nil
+}
 
-			childTitle = extractPlainTextFromRichText(title)
-			if err = fetchAndSaveToObsidianVault(client, mentionPage, emptyList, emptyList, path.Join(*obsidianVault, childTitle), false); err != nil {
-				fmt.Printf("failed to fetch mention page content with page parent: %s\n", childTitle)
-			}
-		default:
-			return fmt.Errorf("unsupported mention page type %s", mentionPage.Parent.Type)
-		}
+// writeQuotedChildren writes the children of the block inside the quote or
+// callout at prefix.
+func writeQuotedChildren(client client.NotionClient, node *blockNode, buffer *bufio.Writer, notePath, prefix string) error {
+	if len(node.children) == 0 {
+		return nil
+	}
 
-		if childTitle != "" {
-			pageMention = "[[" + childTitle + "]]"
+	b := &bytes.Buffer{}
+	childrenBuffer := bufio.NewWriter(b)
 
-			buffer.WriteString(pageMention)
-		}
+	if err := writeChrildren(client, node, childrenBuffer, notePath, 0); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func writeTable(client *notion.Client, tableWidth int, block notion.Block, buffer *bufio.Writer) error {
-	if block.HasChildren() {
-		pageBlocks, err := client.FindBlockChildrenByID(context.Background(), block.ID(), nil)
-		if err != nil {
-			return fmt.Errorf("failed to extract table children blocks for block ID %s. error: %w", block.ID(), err)
-		}
+	if err := childrenBuffer.Flush(); err != nil {
+		return err
+	}
 
-		for rowIndex, object := range pageBlocks.Results {
-			row := object.(*notion.TableRowBlock)
-			for i, cell := range row.Cells {
-				if err = writeRichText(client, buffer, cell); err != nil {
-					return err
-				}
-				buffer.WriteString("|")
-				if i+1 == tableWidth {
-					buffer.WriteString("\n")
-					if rowIndex == 0 {
-						for y := 1; y <= tableWidth; y++ {
-							buffer.WriteString("--|")
-						}
-						buffer.WriteString("\n")
-					}
-				}
-			}
-		}
+	if b.Len() == 0 {
+		return nil
 	}
 
+	writeQuotedLines(buffer, prefix, strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n"))
+
 	return nil
 }
 
-func annotationsToStyle(annotations *notion.Annotations) string {
-	var style string
-	if annotations.Bold {
-		if annotations.Italic {
-			style += "***"
+func writeQuotedLines(buffer *bufio.Writer, prefix string, lines []string) {
+	for _, line := range lines {
+		buffer.WriteString(prefix)
+		if line == "" {
+			buffer.WriteString(">")
 		} else {
-			style += "**"
-		}
-	} else {
-		if annotations.Italic {
-			style += "_"
+			buffer.WriteString("> ")
+			buffer.WriteString(line)
 		}
+		buffer.WriteString("\n")
 	}
+}
 
-	if annotations.Strikethrough {
-		style += "~~"
-	}
+func richTextToString(client client.NotionClient, notePath string, richText []notion.RichText) (string, error) {
+	b := &bytes.Buffer{}
+	buffer := bufio.NewWriter(b)
 
-	if annotations.Color != notion.ColorDefault {
-		style += "=="
+	if err := writeRichText(client, buffer, notePath, richText); err != nil {
+		return "", err
 	}
 
-	if annotations.Code {
-		style += "`"
+	if err := buffer.Flush(); err != nil {
+		return "", err
 	}
 
-	return style
+	return b.String(), nil
 }
 
-func hasAnnotation(annotations *notion.Annotations) bool {
-	return annotations.Bold || annotations.Strikethrough || annotations.Italic || annotations.Code || annotations.Color != notion.ColorDefault
-}
+func writeFileBlock(buffer *bufio.Writer, notePath string, prefix string, fileType notion.FileType, file *notion.FileFile, external *notion.FileExternal, caption []notion.RichText, embed bool) error {
+	link, err := fileLink(notePath, fileType, file, external, extractPlainTextFromRichText(caption), embed)
+	if err != nil {
+		return fmt.Errorf("failed to write file block. error: %w", err)
+	}
 
-func reverseString(s string) string {
-	rns := []rune(s) // convert to rune
-	for i, j := 0, len(rns)-1; i < j; i, j = i+1, j-1 {
+	buffer.WriteString(prefix)
+	buffer.WriteString(link)
+	buffer.WriteString("\n")
 
-		// swap the letters of the string,
-		// like first with last and so on.
-		rns[i], rns[j] = rns[j], rns[i]
-	}
+	return nil
+}
 
-	// return the reversed string.
-	return string(rns)
+func writeChrildren(client client.NotionClient, node *blockNode, buffer *bufio.Writer, notePath string, depth int) error {
+	return pageToMarkdown(client, node.children, buffer, notePath, depth)
 }
 
 func extractPlainTextFromRichText(richText []notion.RichText) string {
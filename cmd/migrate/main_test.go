@@ -3,8 +3,15 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
 	"github.com/dstotijn/go-notion"
 )
 
@@ -142,7 +149,7 @@ func TestWriteRichText_Annotations(t *testing.T) {
 			},
 		},
 		{
-			"**hello **==world ==~~foo~~",
+			"**hello** <span style=\"color: blue\">world</span> ~~foo~~",
 			[]notion.RichText{
 				{
 					Type: notion.RichTextTypeText,
@@ -205,7 +212,7 @@ func TestWriteRichText_Annotations(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(*testing.T) {
-			err := writeRichText(nil, buffer, test.notionRichText)
+			err := writeRichText(nil, buffer, "vault/note.md", test.notionRichText)
 
 			if err != nil {
 				t.Error("expected nil")
@@ -228,3 +235,389 @@ func TestWriteRichText_Annotations(t *testing.T) {
 		})
 	}
 }
+
+func blocksFromJSON(t *testing.T, data string) []notion.Block {
+	t.Helper()
+
+	var response notion.BlockChildrenResponse
+	if err := json.Unmarshal([]byte(`{"results":`+data+`}`), &response); err != nil {
+		t.Fatalf("invalid blocks JSON: %v", err)
+	}
+
+	return response.Results
+}
+
+func blockJSON(id, blockType, text string, hasChildren bool) string {
+	return fmt.Sprintf(`{"object":"block","id":%q,"type":%q,"has_children":%t,%q:{"rich_text":[{"type":"text","text":{"content":%q},"plain_text":%q,"annotations":{"color":"default"}}]}}`, id, blockType, hasChildren, blockType, text, text)
+}
+
+func renderBlocks(t *testing.T, fake *client.Fake, blocks []notion.Block) string {
+	t.Helper()
+
+	b := &bytes.Buffer{}
+	buffer := bufio.NewWriter(b)
+
+	nodes, err := fetchDescendants(fake, blocks)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	if err := pageToMarkdown(fake, nodes, buffer, "note.md", 0); err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	if err := buffer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestPageToMarkdown_NestedIndentation(t *testing.T) {
+	fake := &client.Fake{
+		Blocks: map[string][]notion.Block{
+			"level-1": blocksFromJSON(t, "["+
+				blockJSON("level-2", "bulleted_list_item", "level 2", true)+","+
+				blockJSON("paragraph", "paragraph", "first line\nsecond line", false)+
+				"]"),
+			"level-2": blocksFromJSON(t, "["+
+				blockJSON("level-3", "bulleted_list_item", "level 3", false)+","+
+				`{"object":"block","id":"code","type":"code","code":{"language":"go","rich_text":[{"type":"text","text":{"content":"func main() {\n}"},"plain_text":"func main() {\n}"}]}}`+","+
+				blockJSON("heading", "heading_3", "heading", false)+
+				"]"),
+		},
+	}
+
+	blocks := blocksFromJSON(t, "["+
+		blockJSON("level-1", "bulleted_list_item", "level 1", true)+","+
+		blockJSON("todo", "to_do", "top level", false)+
+		"]")
+
+	expected := "- level 1\n" +
+		"\t- level 2\n" +
+		"\t\t- level 3\n" +
+		"\t\t```go\n" +
+		"\t\tfunc main() {\n" +
+		"\t\t}\n" +
+		"\t\t```\n" +
+		"\t\t### heading\n" +
+		"\tfirst line\n" +
+		"\tsecond line\n" +
+		"- [ ] top level\n"
+
+	result := renderBlocks(t, fake, blocks)
+	if result != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	// Children fetched concurrently render the same
+	fetchSlots = make(chan struct{}, 2)
+	defer func() { fetchSlots = nil }()
+
+	result = renderBlocks(t, fake, blocks)
+	if result != expected {
+		t.Errorf("incorrect result with prefetched children expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestPageToMarkdown_NumberedLists(t *testing.T) {
+	fake := &client.Fake{
+		Blocks: map[string][]notion.Block{
+			"step-2": blocksFromJSON(t, "["+
+				blockJSON("step-2-1", "numbered_list_item", "step 2.1", false)+","+
+				blockJSON("step-2-2", "numbered_list_item", "step 2.2", false)+
+				"]"),
+		},
+	}
+
+	blocks := blocksFromJSON(t, "["+
+		blockJSON("step-1", "numbered_list_item", "step 1", false)+","+
+		blockJSON("step-2", "numbered_list_item", "step 2", true)+","+
+		blockJSON("step-3", "numbered_list_item", "step 3", false)+","+
+		blockJSON("paragraph", "paragraph", "break", false)+","+
+		blockJSON("again-1", "numbered_list_item", "again 1", false)+","+
+		blockJSON("bullet", "bulleted_list_item", "bullet", false)+","+
+		blockJSON("again-2", "numbered_list_item", "again 2", false)+
+		"]")
+
+	expected := "1. step 1\n" +
+		"2. step 2\n" +
+		"\t1. step 2.1\n" +
+		"\t2. step 2.2\n" +
+		"3. step 3\n" +
+		"break\n" +
+		"1. again 1\n" +
+		"- bullet\n" +
+		"1. again 2\n"
+
+	result := renderBlocks(t, fake, blocks)
+	if result != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestPageToMarkdown_CalloutsTogglesAndQuotes(t *testing.T) {
+	fake := &client.Fake{
+		Blocks: map[string][]notion.Block{
+			"callout": blocksFromJSON(t, "["+
+				blockJSON("callout-paragraph", "paragraph", "inside callout", false)+","+
+				blockJSON("callout-bullet", "bulleted_list_item", "callout bullet", false)+
+				"]"),
+			"toggle": blocksFromJSON(t, "["+
+				blockJSON("toggle-paragraph", "paragraph", "hidden content", false)+
+				"]"),
+			"quote": blocksFromJSON(t, "["+
+				blockJSON("quote-paragraph", "paragraph", "quoted child", false)+
+				"]"),
+		},
+	}
+
+	blocks := blocksFromJSON(t, "["+
+		`{"object":"block","id":"callout","type":"callout","has_children":true,"callout":{"icon":{"type":"emoji","emoji":"⚠️"},"rich_text":[{"type":"text","text":{"content":"Careful"},"plain_text":"Careful","annotations":{"color":"default"}}]}}`+","+
+		blockJSON("toggle", "toggle", "Details", true)+","+
+		blockJSON("quote", "quote", "first line\nsecond line", true)+","+
+		blockJSON("list", "bulleted_list_item", "list", true)+
+		"]")
+
+	fake.Blocks["list"] = blocksFromJSON(t, "["+blockJSON("nested-toggle", "toggle", "nested", true)+"]")
+	fake.Blocks["nested-toggle"] = blocksFromJSON(t, "["+blockJSON("nested-toggle-paragraph", "paragraph", "nested content", false)+"]")
+
+	expected := "> [!warning] Careful\n" +
+		"> inside callout\n" +
+		"> - callout bullet\n" +
+		"\n" +
+		"> [!note]- Details\n" +
+		"> hidden content\n" +
+		"\n" +
+		"> first line\n" +
+		"> second line\n" +
+		"> quoted child\n" +
+		"\n" +
+		"- list\n" +
+		"\t> [!note]- nested\n" +
+		"\t> nested content\n"
+
+	result := renderBlocks(t, fake, blocks)
+	if result != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestPageToMarkdown_SyncedBlocksAndPlaceholders(t *testing.T) {
+	fake := &client.Fake{
+		Blocks: map[string][]notion.Block{
+			"original": blocksFromJSON(t, "["+
+				blockJSON("synced-paragraph", "paragraph", "synced content", false)+
+				"]"),
+		},
+		Pages: map[string]notion.Page{
+			"page": {
+				ID:         "page",
+				Parent:     notion.Parent{Type: notion.ParentTypePage, PageID: "root"},
+				Properties: notion.PageProperties{Title: notion.PageTitle{Title: []notion.RichText{{PlainText: "Page"}}}},
+			},
+			"root": {
+				ID:         "root",
+				Parent:     notion.Parent{Type: notion.ParentTypeWorkspace},
+				Properties: notion.PageProperties{Title: notion.PageTitle{Title: []notion.RichText{{PlainText: "Root"}}}},
+			},
+		},
+	}
+
+	blocks := blocksFromJSON(t, "["+
+		`{"object":"block","id":"original","type":"synced_block","has_children":true,"synced_block":{"synced_from":null}}`+","+
+		`{"object":"block","id":"duplicate","type":"synced_block","has_children":true,"synced_block":{"synced_from":{"type":"block_id","block_id":"original"}}}`+","+
+		`{"object":"block","id":"breadcrumb","type":"breadcrumb","parent":{"type":"page_id","page_id":"page"},"breadcrumb":{}}`+","+
+		`{"object":"block","id":"preview","type":"link_preview","link_preview":{"url":"https://github.com/GustavoCaso/notion_workflows"}}`+","+
+		`{"object":"block","id":"unsupported","type":"unsupported","unsupported":{}}`+","+
+		blockJSON("after", "paragraph", "after", false)+
+		"]")
+
+	expected := "synced content\n" +
+		"synced content\n" +
+		"[[Root]] / [[Page]]\n" +
+		"https://github.com/GustavoCaso/notion_workflows\n" +
+		"> [!warning] Unsupported block: Unsupported\n" +
+		"\n" +
+		"after\n"
+
+	result := renderBlocks(t, fake, blocks)
+	if result != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestInsertTableOfContents(t *testing.T) {
+	content := "# Title\n" +
+		tocMarker + "\n" +
+		"## First [[link]]\n" +
+		"```md\n" +
+		"# not a heading\n" +
+		"```\n" +
+		"### Nested\n" +
+		"## Second\n"
+
+	expected := "# Title\n" +
+		"- [[#Title]]\n" +
+		"\t- [[#First link]]\n" +
+		"\t\t- [[#Nested]]\n" +
+		"\t- [[#Second]]\n" +
+		"## First [[link]]\n" +
+		"```md\n" +
+		"# not a heading\n" +
+		"```\n" +
+		"### Nested\n" +
+		"## Second\n"
+
+	result := insertTableOfContents(content)
+	if result != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func cellJSON(text string) string {
+	return fmt.Sprintf(`[{"type":"text","text":{"content":%q},"plain_text":%q,"annotations":{"color":"default"}}]`, text, text)
+}
+
+func tableRowJSON(id string, cells ...string) string {
+	return fmt.Sprintf(`{"object":"block","id":%q,"type":"table_row","table_row":{"cells":[%s]}}`, id, strings.Join(cells, ","))
+}
+
+func TestPageToMarkdown_Tables(t *testing.T) {
+	fake := &client.Fake{
+		Blocks: map[string][]notion.Block{
+			"list": blocksFromJSON(t, "["+
+				`{"object":"block","id":"headers","type":"table","has_children":true,"table":{"table_width":2,"has_column_header":true,"has_row_header":true}}`+
+				"]"),
+			"headers": blocksFromJSON(t, "["+
+				tableRowJSON("row-1", cellJSON("Name"), cellJSON("Value"))+","+
+				tableRowJSON("row-2", cellJSON("a|b"), cellJSON("first\nsecond"))+
+				"]"),
+			"plain": blocksFromJSON(t, "["+
+				tableRowJSON("row-1", cellJSON("1"), cellJSON("2"))+
+				"]"),
+		},
+	}
+
+	blocks := blocksFromJSON(t, "["+
+		blockJSON("list", "bulleted_list_item", "list", true)+","+
+		`{"object":"block","id":"plain","type":"table","has_children":true,"table":{"table_width":2,"has_column_header":false,"has_row_header":false}}`+","+
+		blockJSON("after", "paragraph", "after", false)+
+		"]")
+
+	expected := "- list\n" +
+		"\n" +
+		"\t| Name     | Value           |\n" +
+		"\t| -------- | --------------- |\n" +
+		"\t| **a\\|b** | first<br>second |\n" +
+		"\n" +
+		"|     |     |\n" +
+		"| --- | --- |\n" +
+		"| 1   | 2   |\n" +
+		"\n" +
+		"after\n"
+
+	result := renderBlocks(t, fake, blocks)
+	if result != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestRunWorkers(t *testing.T) {
+	var mu sync.Mutex
+	ran := map[string]bool{}
+	running := 0
+	overlapped := false
+
+	jobs := []job{}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		id := id
+		jobs = append(jobs, job{
+			id:   id,
+			path: id + ".md",
+			run: func() error {
+				mu.Lock()
+				ran[id] = true
+				running++
+				if running > 1 {
+					overlapped = true
+				}
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+
+				if id == "b" || id == "d" {
+					return fmt.Errorf("failed to migrate. error: %w", errors.New(id))
+				}
+				return nil
+			},
+		})
+	}
+
+	queue := newQueue("testing")
+	queue.addJobs(jobs)
+
+	errorJobs := runWorkers(queue, nil, 3)
+
+	if len(ran) != 5 {
+		t.Errorf("incorrect jobs run expected 5 got: %d", len(ran))
+	}
+	if !overlapped {
+		t.Errorf("expected jobs to run concurrently")
+	}
+
+	failed := []string{}
+	for _, errJob := range errorJobs {
+		failed = append(failed, errJob.job.id)
+	}
+	if len(failed) != 2 || !strings.Contains(strings.Join(failed, ","), "b") || !strings.Contains(strings.Join(failed, ","), "d") {
+		t.Errorf("incorrect failed jobs expected [b d] got: %v", failed)
+	}
+}
+
+func TestRunWorkers_AddedJobs(t *testing.T) {
+	var mu sync.Mutex
+	ran := []string{}
+
+	queue := newQueue("testing")
+
+	// Each job adds the jobs of its children, like the discovery of sub pages
+	var add func(ids ...string)
+	add = func(ids ...string) {
+		jobs := []job{}
+		for _, id := range ids {
+			id := id
+			jobs = append(jobs, job{
+				id: id,
+				run: func() error {
+					mu.Lock()
+					ran = append(ran, id)
+					mu.Unlock()
+
+					if len(id) < 3 {
+						add(id+"a", id+"b")
+					}
+					return nil
+				},
+			})
+		}
+		queue.addJobs(jobs)
+	}
+	add("a", "b")
+
+	if errorJobs := runWorkers(queue, nil, 3); len(errorJobs) != 0 {
+		t.Fatalf("incorrect failed jobs expected none got: %v", errorJobs)
+	}
+
+	// Two roots with two levels of two children
+	if len(ran) != 14 {
+		t.Errorf("incorrect jobs run expected 14 got: %d %v", len(ran), ran)
+	}
+	if total := queue.progressBar.GetMax(); total != 14 {
+		t.Errorf("incorrect progress expected 14 jobs got: %d", total)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/itchyny/timefmt-go"
+)
+
+const (
+	mappingTypeText   = "text"
+	mappingTypeNumber = "number"
+	mappingTypeDate   = "date"
+	mappingTypeList   = "list"
+	mappingTypeTag    = "tag"
+	mappingTypeTags   = "tags"
+	mappingTypeLink   = "link"
+
+	defaultMappingDateFormat = "%Y-%m-%d"
+)
+
+// propertyMapping describes how Notion properties become front matter keys.
+//
+//	{
+//	  "properties": {
+//	    "Habit Tracker (Relation)": {"key": "habits"},
+//	    "Status": {"key": "tags", "type": "tag"},
+//	    "Topics": {"type": "tags"},
+//	    "Date": {"key": "day", "type": "date", "format": "%Y-%m-%d"},
+//	    "Internal notes": {"skip": true}
+//	  },
+//	  "static": {"source": "notion", "notion_url": "{{.URL}}"},
+//	  "only_mapped": false
+//	}
+type propertyMapping struct {
+	Properties map[string]propertyRule `json:"properties"`
+	// Static fields are added to every page. String values are templates
+	// executed with the notion.Page, so they can be computed from the page.
+	Static map[string]interface{} `json:"static"`
+	// OnlyMapped drops the properties without a rule.
+	OnlyMapped bool `json:"only_mapped"`
+}
+
+type propertyRule struct {
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	Format string `json:"format"`
+	Skip   bool   `json:"skip"`
+}
+
+var frontMatterMapping *propertyMapping
+
+func loadPropertyMapping(path string) (*propertyMapping, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read property mapping %s. error: %w", path, err)
+	}
+
+	mapping := &propertyMapping{}
+	if err = json.Unmarshal(content, mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse property mapping %s. error: %w", path, err)
+	}
+
+	// Property names are matched case insensitive, like the -id include and
+	// skip lists.
+	rules := map[string]propertyRule{}
+	for name, rule := range mapping.Properties {
+		switch rule.Type {
+		case "", mappingTypeText, mappingTypeNumber, mappingTypeDate, mappingTypeList, mappingTypeTag, mappingTypeTags, mappingTypeLink:
+		default:
+			return nil, fmt.Errorf("unsupported type %q for property %s", rule.Type, name)
+		}
+		rules[strings.ToLower(name)] = rule
+	}
+	mapping.Properties = rules
+
+	return mapping, nil
+}
+
+// apply renames and converts the fields, and adds the static ones.
+func (m *propertyMapping) apply(fields []frontMatterField, page notion.Page) ([]frontMatterField, error) {
+	result := []frontMatterField{}
+	indexes := map[string]int{}
+
+	add := func(field frontMatterField, source string) error {
+		index, ok := indexes[field.key]
+		if !ok {
+			indexes[field.key] = len(result)
+			result = append(result, field)
+			return nil
+		}
+
+		// Several properties can feed the same list, e.g. tags
+		existing, existingIsList := result[index].value.([]interface{})
+		list, isList := field.value.([]interface{})
+		if !existingIsList || !isList {
+			return fmt.Errorf("%s and another property are both mapped to %s", source, field.key)
+		}
+		result[index].value = append(existing, list...)
+		result[index].title = result[index].title || field.title
+		return nil
+	}
+
+	for _, field := range fields {
+		key, ok := m.key(field.key)
+		if !ok {
+			continue
+		}
+
+		rule, ok := m.Properties[strings.ToLower(field.key)]
+		if !ok {
+			if err := add(field, field.key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		value, err := convertValue(field.value, rule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert property %s. error: %w", field.key, err)
+		}
+
+		if err = add(frontMatterField{key: key, value: value, title: field.title}, field.key); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, value := range m.Static {
+		staticValue, err := staticValue(value, page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute static field %s. error: %w", key, err)
+		}
+		if err = add(frontMatterField{key: key, value: staticValue}, "static field "+key); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// key returns the front matter key of the property, and false when the
+// property is dropped.
+func (m *propertyMapping) key(property string) (string, bool) {
+	rule, ok := m.Properties[strings.ToLower(property)]
+	if !ok {
+		return property, !m.OnlyMapped
+	}
+
+	if rule.Skip {
+		return "", false
+	}
+
+	if rule.Key != "" {
+		return rule.Key, true
+	}
+
+	if rule.Type == mappingTypeTags || rule.Type == mappingTypeTag {
+		return "tags", true
+	}
+
+	return property, true
+}
+
+func convertValue(value interface{}, rule propertyRule) (interface{}, error) {
+	if value == nil {
+		if rule.Type == mappingTypeTags || rule.Type == mappingTypeTag || rule.Type == mappingTypeList {
+			return []interface{}{}, nil
+		}
+		return nil, nil
+	}
+
+	switch rule.Type {
+	case mappingTypeText:
+		if list, ok := value.([]interface{}); ok {
+			items := []string{}
+			for _, item := range list {
+				items = append(items, plainText(item))
+			}
+			return strings.Join(items, ", "), nil
+		}
+		return plainText(value), nil
+	case mappingTypeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case bool:
+			if v {
+				return 1.0, nil
+			}
+			return 0.0, nil
+		case string:
+			if v == "" {
+				return nil, nil
+			}
+			return strconv.ParseFloat(strings.TrimSpace(v), 64)
+		}
+		return nil, fmt.Errorf("can not convert %v to a number", value)
+	case mappingTypeDate:
+		format := rule.Format
+		if format == "" {
+			format = defaultMappingDateFormat
+		}
+		switch v := value.(type) {
+		case notion.DateTime:
+			return timefmt.Format(v.Time, format), nil
+		case time.Time:
+			return timefmt.Format(v, format), nil
+		case string:
+			if v == "" {
+				return nil, nil
+			}
+			date, err := notion.ParseDateTime(v)
+			if err != nil {
+				return nil, fmt.Errorf("can not convert %q to a date", v)
+			}
+			return timefmt.Format(date.Time, format), nil
+		}
+		return nil, fmt.Errorf("can not convert %v to a date", value)
+	case mappingTypeList:
+		if list, ok := value.([]interface{}); ok {
+			return list, nil
+		}
+		return []interface{}{value}, nil
+	case mappingTypeTag, mappingTypeTags:
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		tags := []interface{}{}
+		for _, v := range values {
+			if tag := toTag(plainText(v)); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		return tags, nil
+	case mappingTypeLink:
+		if list, ok := value.([]interface{}); ok {
+			links := []interface{}{}
+			for _, item := range list {
+				links = append(links, toLink(plainText(item)))
+			}
+			return links, nil
+		}
+		return toLink(plainText(value)), nil
+	}
+
+	return value, nil
+}
+
+var tagInvalidCharacters = regexp.MustCompile(`[^\p{L}\p{N}_\-/]+`)
+
+// toTag turns s into a valid Obsidian tag: no spaces, no leading # and only
+// letters, numbers, underscores, dashes and slashes for nested tags.
+func toTag(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	s = strings.Join(strings.Fields(s), "-")
+	s = tagInvalidCharacters.ReplaceAllString(s, "")
+	return strings.Trim(s, "/")
+}
+
+func toLink(s string) string {
+	if strings.HasPrefix(s, "[[") || s == "" {
+		return s
+	}
+	return "[[" + s + "]]"
+}
+
+func staticValue(value interface{}, page notion.Page) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		t, err := template.New("static").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		b := &bytes.Buffer{}
+		if err = t.Execute(b, page); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	case []interface{}:
+		result := []interface{}{}
+		for _, item := range v {
+			itemValue, err := staticValue(item, page)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, itemValue)
+		}
+		return result, nil
+	}
+
+	return value, nil
+}
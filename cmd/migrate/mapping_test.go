@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestPropertyMapping_Apply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	content := `{
+  "properties": {
+    "Habit Tracker (Relation)": {"key": "habits"},
+    "status": {"type": "tag"},
+    "Topics": {"type": "tags"},
+    "Date": {"key": "day", "type": "date", "format": "%d/%m/%Y"},
+    "Internal": {"skip": true}
+  },
+  "static": {"source": "notion", "id": "{{.ID}}"}
+}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mapping, err := loadPropertyMapping(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date, _ := notion.ParseDateTime("2023-04-05")
+
+	fields := []frontMatterField{
+		{key: "Name", value: "Week 1", title: true},
+		{key: "Habit Tracker (Relation)", value: []interface{}{"[[Run]]"}},
+		{key: "Status", value: "In progress"},
+		{key: "Topics", value: []interface{}{"Deep Work", "#focus"}},
+		{key: "Date", value: date},
+		{key: "Internal", value: "secret"},
+	}
+
+	result, err := mapping.apply(fields, notion.Page{ID: "page-id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []frontMatterField{
+		{key: "Name", value: "Week 1", title: true},
+		{key: "habits", value: []interface{}{"[[Run]]"}},
+		{key: "tags", value: []interface{}{"In-progress", "Deep-Work", "focus"}},
+		{key: "day", value: "05/04/2023"},
+	}
+
+	static := map[string]interface{}{}
+	for _, field := range result[len(expected):] {
+		static[field.key] = field.value
+	}
+
+	if !reflect.DeepEqual(result[:len(expected)], expected) {
+		t.Errorf("incorrect fields expected %+v got: %+v", expected, result[:len(expected)])
+	}
+
+	if !reflect.DeepEqual(static, map[string]interface{}{"source": "notion", "id": "page-id"}) {
+		t.Errorf("incorrect static fields got: %+v", static)
+	}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/itchyny/timefmt-go"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	collisionSuffix = "suffix"
+	collisionFolder = "folder"
+	collisionFail   = "fail"
+
+	// maxFileNameLength leaves room for the extension and a collision suffix
+	// within the 255 bytes most file systems allow.
+	maxFileNameLength = 200
+)
+
+// noteExtension is the extension of the files written for the pages.
+var noteExtension = ".md"
+
+var reservedFileNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeFileName returns name without the characters that are invalid in
+// file names or that break Obsidian links. Names are normalized to NFC so the
+// same title always maps to the same file.
+func sanitizeFileName(name string) string {
+	name = norm.NFC.String(name)
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':' || r == '|':
+			return '-'
+		case r == '?' || r == '*' || r == '"' || r == '<' || r == '>' || r == '#' || r == '^' || r == '[' || r == ']':
+			return -1
+		case unicode.IsControl(r):
+			return ' '
+		}
+		return r
+	}, name)
+
+	name = strings.Join(strings.Fields(name), " ")
+	// Hidden files are ignored by Obsidian and Windows drops trailing dots
+	name = strings.TrimLeft(name, ".")
+	name = strings.TrimRight(name, ". ")
+
+	if len(name) > maxFileNameLength {
+		cut := maxFileNameLength
+		for cut > 0 && !utf8RuneStart(name[cut]) {
+			cut--
+		}
+		name = strings.TrimRight(name[:cut], ". ")
+	}
+
+	if reservedFileNames[strings.ToUpper(name)] {
+		name += "_"
+	}
+
+	if name == "" {
+		return "Untitled"
+	}
+
+	return name
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// shortID returns the first characters of the Notion ID, enough to tell
+// apart pages with the same name.
+func shortID(id string) string {
+	id = strings.ReplaceAll(id, "-", "")
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// notePaths gives every page its own path in the vault. Pages keep the path
+// they were written to on previous runs. It also knows the title of the pages
+// to link to them.
+type notePaths struct {
+	vault    string
+	strategy string
+	owners   map[string]string
+	paths    map[string]string
+	titles   map[string]string
+	// previous holds the paths of the pages migrated on previous runs, so
+	// pages that did not change can still be linked to
+	previous map[string]string
+	// names holds the pages of every file name, to find the links that need
+	// the path within the vault
+	names map[string]map[string]bool
+	mu    sync.Mutex
+}
+
+var pagePaths *notePaths
+
+func newNotePaths(vault, strategy string, state *syncState) (*notePaths, error) {
+	if strategy != collisionSuffix && strategy != collisionFolder && strategy != collisionFail {
+		return nil, fmt.Errorf("unsupported collision strategy %q. use %s, %s or %s", strategy, collisionSuffix, collisionFolder, collisionFail)
+	}
+
+	n := &notePaths{
+		vault:    vault,
+		strategy: strategy,
+		owners:   map[string]string{},
+		paths:    map[string]string{},
+		titles:   map[string]string{},
+		previous: map[string]string{},
+		names:    map[string]map[string]bool{},
+	}
+
+	if state != nil {
+		for id, page := range state.Pages {
+			n.owners[pathKey(page.Path)] = id
+			n.previous[id] = page.Path
+			n.addName(id, page.Path)
+			if page.Title != "" {
+				n.titles[id] = page.Title
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// pathKey ignores the case, as file systems on macOS and Windows do.
+func pathKey(path string) string {
+	return strings.ToLower(norm.NFC.String(path))
+}
+
+// nameKey returns the file name of the note at path, ignoring the case as
+// links do.
+func nameKey(path string) string {
+	return pathKey(strings.TrimSuffix(filepath.Base(path), noteExtension))
+}
+
+func (n *notePaths) addName(pageID, path string) {
+	key := nameKey(path)
+	if n.names[key] == nil {
+		n.names[key] = map[string]bool{}
+	}
+	n.names[key][pageID] = true
+}
+
+// setPath gives the page its path for this run, which takes precedence over
+// the one of previous runs. It must be called with the lock held.
+func (n *notePaths) setPath(pageID, path string) {
+	old, ok := n.paths[pageID]
+	if !ok {
+		old, ok = n.previous[pageID]
+	}
+	if ok {
+		delete(n.names[nameKey(old)], pageID)
+	}
+
+	n.owners[pathKey(path)] = pageID
+	n.paths[pageID] = path
+	n.addName(pageID, path)
+}
+
+// assign returns the path the page is written to, resolving collisions with
+// other pages wanting the same one.
+func (n *notePaths) assign(pageID, path string) (string, error) {
+	if n == nil {
+		return path, nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if owner, ok := n.owners[pathKey(path)]; !ok || owner == pageID {
+		n.setPath(pageID, path)
+		return path, nil
+	}
+
+	dir, file := filepath.Split(path)
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+
+	var alternative string
+	switch n.strategy {
+	case collisionSuffix:
+		alternative = filepath.Join(dir, fmt.Sprintf("%s %s%s", base, shortID(pageID), ext))
+	case collisionFolder:
+		alternative = filepath.Join(dir, shortID(pageID), file)
+	default:
+		return "", fmt.Errorf("page %s and page %s would both be written to %s", n.owners[pathKey(path)], pageID, path)
+	}
+
+	if owner, ok := n.owners[pathKey(alternative)]; ok && owner != pageID {
+		return "", fmt.Errorf("page %s and page %s would both be written to %s", owner, pageID, alternative)
+	}
+
+	n.setPath(pageID, alternative)
+	return alternative, nil
+}
+
+// pathOf returns the path assigned to the page during this run.
+func (n *notePaths) pathOf(pageID string) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	path, ok := n.paths[pageID]
+	return path, ok
+}
+
+// move changes the path of the page, e.g. when it becomes a folder note.
+func (n *notePaths) move(pageID, path string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.setPath(pageID, path)
+}
+
+// setTitle records the title of the page, used as the alias of its links.
+func (n *notePaths) setTitle(pageID, title string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.titles[pageID] = title
+}
+
+// target returns the path and title of the note of the page, when the page
+// is migrated on this run or was migrated before.
+func (n *notePaths) target(pageID string) (string, string, bool) {
+	if n == nil {
+		return "", "", false
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	path, ok := n.paths[pageID]
+	if !ok {
+		path, ok = n.previous[pageID]
+	}
+	title, titled := n.titles[pageID]
+	if !ok || !titled {
+		return "", "", false
+	}
+
+	return path, title, true
+}
+
+// link returns the wikilink to the note of the page. Links point to the file
+// name, and to the path within the vault when several notes share the name.
+func (n *notePaths) link(pageID, title string) string {
+	if n == nil {
+		return "[[" + title + "]]"
+	}
+
+	n.mu.Lock()
+	path, ok := n.paths[pageID]
+	if !ok {
+		path, ok = n.previous[pageID]
+	}
+	if !ok {
+		n.mu.Unlock()
+		return "[[" + title + "]]"
+	}
+
+	ambiguous := len(n.names[nameKey(path)]) > 1
+	n.mu.Unlock()
+
+	target := strings.TrimSuffix(filepath.Base(path), noteExtension)
+	if ambiguous {
+		if rel, err := filepath.Rel(n.vault, path); err == nil {
+			target = filepath.ToSlash(strings.TrimSuffix(rel, noteExtension))
+		}
+	}
+
+	// The title is the alias of the link, so it can not close it
+	title = strings.NewReplacer("|", "-", "[", "", "]", "").Replace(title)
+	if target == title || title == "" {
+		return "[[" + target + "]]"
+	}
+	return "[[" + target + "|" + title + "]]"
+}
+
+// parsePathTemplate parses the -path flag. It is either a Go template over
+// the page properties, ex {{.Date | date "%Y/%m"}}/{{.Name}}, or a comma
+// separated list of properties joined together, ex date:%Y-%m-%d,name.
+func parsePathTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = "{{.title}}"
+	} else if !strings.Contains(text, "{{") {
+		text = legacyPathTemplate(text)
+	}
+
+	tmpl, err := template.New("path").Option("missingkey=error").Funcs(template.FuncMap{
+		"date":  formatPathDate,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse path template %q. error: %w", text, err)
+	}
+
+	return tmpl, nil
+}
+
+func legacyPathTemplate(text string) string {
+	b := &strings.Builder{}
+	for _, attribute := range strings.Split(text, ",") {
+		nameAndFormat := strings.SplitN(attribute, ":", 2)
+		format := "%Y-%m-%d"
+		if len(nameAndFormat) > 1 {
+			format = nameAndFormat[1]
+		}
+		b.WriteString(fmt.Sprintf("{{date %q (index . %q)}}", format, strings.ToLower(nameAndFormat[0])))
+	}
+	return b.String()
+}
+
+// filePath returns the path of the page in the vault. Each folder of the
+// path is sanitized on its own, so templates can nest pages in folders.
+func filePath(page notion.Page, tmpl *template.Template) (string, error) {
+	b := &strings.Builder{}
+	if err := tmpl.Execute(b, pathData(page)); err != nil {
+		return "", fmt.Errorf("failed to compute the path of page %s. error: %w", page.ID, err)
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(strings.TrimSuffix(b.String(), noteExtension), "/") {
+		if strings.TrimSpace(segment) == "" {
+			continue
+		}
+		segments = append(segments, sanitizeFileName(segment))
+	}
+
+	if len(segments) == 0 {
+		segments = append(segments, sanitizeFileName(""))
+	}
+
+	segments[len(segments)-1] += noteExtension
+
+	return filepath.Join(append([]string{*obsidianVault}, segments...)...), nil
+}
+
+// pathData returns the page properties by name, and by lowercase name for
+// the legacy syntax. The title is also available as title.
+func pathData(page notion.Page) map[string]interface{} {
+	data := map[string]interface{}{}
+
+	props, ok := page.Properties.(notion.DatabasePageProperties)
+	if !ok {
+		data["title"] = pathString(pageTitle(page))
+		return data
+	}
+
+	for name, prop := range props {
+		value := pathValue(prop)
+		data[name] = value
+		if _, exists := data[strings.ToLower(name)]; !exists {
+			data[strings.ToLower(name)] = value
+		}
+	}
+	data["title"] = pathString(pageTitle(page))
+
+	return data
+}
+
+func pathValue(prop notion.DatabasePageProperty) interface{} {
+	switch prop.Type {
+	case notion.DBPropTypeTitle:
+		return pathString(extractPlainTextFromRichText(prop.Title))
+	case notion.DBPropTypeRichText:
+		return pathString(extractPlainTextFromRichText(prop.RichText))
+	case notion.DBPropTypeNumber:
+		if prop.Number != nil {
+			return strconv.FormatFloat(*prop.Number, 'f', -1, 64)
+		}
+	case notion.DBPropTypeSelect:
+		if prop.Select != nil {
+			return pathString(prop.Select.Name)
+		}
+	case notion.DBPropTypeStatus:
+		if prop.Status != nil {
+			return pathString(prop.Status.Name)
+		}
+	case notion.DBPropTypeMultiSelect:
+		names := []string{}
+		for _, option := range prop.MultiSelect {
+			names = append(names, pathString(option.Name))
+		}
+		return strings.Join(names, ", ")
+	case notion.DBPropTypeDate:
+		if prop.Date != nil {
+			return prop.Date.Start.Time
+		}
+	case notion.DBPropTypeCheckbox:
+		return prop.Checkbox != nil && *prop.Checkbox
+	case notion.DBPropTypeURL:
+		if prop.URL != nil {
+			return pathString(*prop.URL)
+		}
+	case notion.DBPropTypeEmail:
+		if prop.Email != nil {
+			return pathString(*prop.Email)
+		}
+	case notion.DBPropTypePhoneNumber:
+		if prop.PhoneNumber != nil {
+			return pathString(*prop.PhoneNumber)
+		}
+	case notion.DBPropTypeFormula:
+		if prop.Formula == nil {
+			break
+		}
+		switch prop.Formula.Type {
+		case notion.FormulaResultTypeString:
+			if prop.Formula.String != nil {
+				return pathString(*prop.Formula.String)
+			}
+		case notion.FormulaResultTypeNumber:
+			if prop.Formula.Number != nil {
+				return strconv.FormatFloat(*prop.Formula.Number, 'f', -1, 64)
+			}
+		case notion.FormulaResultTypeDate:
+			if prop.Formula.Date != nil {
+				return prop.Formula.Date.Start.Time
+			}
+		}
+	case notion.DBPropTypeCreatedTime:
+		if prop.CreatedTime != nil {
+			return *prop.CreatedTime
+		}
+	case notion.DBPropTypeLastEditedTime:
+		if prop.LastEditedTime != nil {
+			return *prop.LastEditedTime
+		}
+	}
+
+	return ""
+}
+
+// pathString keeps property values within a single folder of the path.
+func pathString(s string) string {
+	return strings.ReplaceAll(s, "/", "-")
+}
+
+// formatPathDate formats the date with a strftime format. Values that are
+// not dates are written as they are.
+func formatPathDate(format string, value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return timefmt.Format(v, format)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := map[string]string{
+		"Meeting: notes/draft":   "Meeting- notes-draft",
+		"What? #1 [[link]] ^ref": "What 1 link ref",
+		"  .hidden.  ":           "hidden",
+		"line\nbreak":            "line break",
+		"":                       "Untitled",
+		"???":                    "Untitled",
+		"con":                    "con_",
+		"Cafe\u0301":             "Caf\u00e9",
+	}
+
+	for name, expected := range tests {
+		if result := sanitizeFileName(name); result != expected {
+			t.Errorf("incorrect file name for %q expected %q got: %q", name, expected, result)
+		}
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	vault := *obsidianVault
+	*obsidianVault = "vault"
+	defer func() { *obsidianVault = vault }()
+
+	date := notion.NewDateTime(time.Date(2023, 4, 5, 0, 0, 0, 0, time.UTC), false)
+	page := notion.Page{
+		ID: "page",
+		Properties: notion.DatabasePageProperties{
+			"Name":   {Type: notion.DBPropTypeTitle, Title: []notion.RichText{{PlainText: "Plan: A/B"}}},
+			"Date":   {Type: notion.DBPropTypeDate, Date: &notion.Date{Start: date}},
+			"Status": {Type: notion.DBPropTypeStatus},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"", "vault/Plan- A-B.md"},
+		{"date:%Y-%m-%d,name", "vault/2023-04-05Plan- A-B.md"},
+		{"name,status", "vault/Plan- A-B.md"},
+		{`{{.Date | date "%Y/%m"}}/{{.Name}}`, "vault/2023/04/Plan- A-B.md"},
+		{`{{.Status}}/{{.Name | lower}}.md`, "vault/plan- a-b.md"},
+	}
+
+	for _, test := range tests {
+		tmpl, err := parsePathTemplate(test.path)
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+
+		result, err := filePath(page, tmpl)
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+
+		if result != filepath.FromSlash(test.expected) {
+			t.Errorf("incorrect path for %q expected %q got: %q", test.path, test.expected, result)
+		}
+	}
+
+	tmpl, err := parsePathTemplate("{{.Missing}}")
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if _, err = filePath(page, tmpl); err == nil {
+		t.Error("expected an error for a missing property")
+	}
+}
+
+func TestNotePaths_Assign(t *testing.T) {
+	state := &syncState{
+		Pages: map[string]pageState{
+			"existing-page": {Path: "vault/Note.md"},
+		},
+	}
+
+	tests := []struct {
+		strategy string
+		expected string
+	}{
+		{collisionSuffix, "vault/note newpagei.md"},
+		{collisionFolder, "vault/newpagei/note.md"},
+	}
+
+	for _, test := range tests {
+		paths, err := newNotePaths("vault", test.strategy, state)
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+
+		if path, err := paths.assign("existing-page", "vault/Note.md"); err != nil || path != "vault/Note.md" {
+			t.Errorf("expected the page to keep its path got: %q %v", path, err)
+		}
+
+		path, err := paths.assign("new-page-id", "vault/note.md")
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+		if path != filepath.FromSlash(test.expected) {
+			t.Errorf("incorrect path for %s expected %q got: %q", test.strategy, test.expected, path)
+		}
+	}
+
+	paths, err := newNotePaths("vault", collisionFail, state)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if _, err = paths.assign("new-page-id", "vault/Note.md"); err == nil {
+		t.Error("expected an error for colliding pages")
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+const (
+	formatObsidian   = "obsidian"
+	formatLogseq     = "logseq"
+	formatHugo       = "hugo"
+	formatCommonMark = "commonmark"
+
+	frontMatterYAML = "yaml"
+	frontMatterTOML = "toml"
+)
+
+var (
+	tomlBareKeyRegex  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	logseqTaskRegex   = regexp.MustCompile(`^(\t*)- \[( |x)\] `)
+	numberedItemRegex = regexp.MustCompile(`^\d+\. `)
+	logseqKeyReplacer = strings.NewReplacer(" ", "-", "_", "-", ":", "")
+)
+
+// renderer writes the syntax that differs between the markdown flavours the
+// pages are migrated to. pageToMarkdown walks the block tree and asks the
+// renderer for anything beyond CommonMark.
+type renderer interface {
+	// writeBody writes the blocks of the page.
+	writeBody(client client.NotionClient, nodes []*blockNode, buffer *bufio.Writer, notePath string) error
+	// frontMatter writes the properties of the page at the top of the note at
+	// notePath. Fields are nil for the pages without exported properties.
+	frontMatter(buffer *bufio.Writer, notePath string, page notion.Page, fields []frontMatterField)
+	// link returns the link from the note at notePath to the note at path.
+	link(notePath, pageID, path, title string) string
+	// externalLink returns the link to a page outside of the migration.
+	externalLink(title, url string) string
+	// reference returns a reference by name to a database or a date.
+	reference(name string) string
+	// frontMatterLinks reports whether links work within the front matter.
+	frontMatterLinks() bool
+	// callout returns the first line of a callout, empty to leave it out.
+	callout(kind, title string, folded bool) string
+	// equation returns a block or an inline equation.
+	equation(expression string, block bool) string
+	// placeholder returns the notice left for content that could not be
+	// migrated, visible when reading the note.
+	placeholder(text string) string
+	// headingLink returns the link to a heading of the same note, empty when
+	// the format can not link to headings.
+	headingLink(heading string) string
+	// delimiters returns the delimiters of the annotations CommonMark has no
+	// syntax for: colors, highlights and underlines.
+	delimiters(m mark) (string, string)
+}
+
+// output is the renderer selected with -format.
+var output renderer = obsidian{}
+
+func newRenderer(format, frontMatter string) (renderer, error) {
+	if frontMatter != frontMatterYAML && frontMatter != frontMatterTOML {
+		return nil, fmt.Errorf("unsupported front matter %q. use %s or %s", frontMatter, frontMatterYAML, frontMatterTOML)
+	}
+
+	switch format {
+	case formatObsidian:
+		return obsidian{}, nil
+	case formatLogseq:
+		return logseq{}, nil
+	case formatHugo:
+		return hugo{toml: frontMatter == frontMatterTOML}, nil
+	case formatCommonMark:
+		return commonMark{}, nil
+	case formatHTML:
+		return htmlSite{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported format %q. use %s, %s, %s, %s or %s", format, formatObsidian, formatLogseq, formatHugo, formatCommonMark, formatHTML)
+}
+
+// obsidian writes Obsidian flavoured markdown: wikilinks, callouts,
+// highlights and comments.
+type obsidian struct{}
+
+func (obsidian) writeBody(client client.NotionClient, nodes []*blockNode, buffer *bufio.Writer, notePath string) error {
+	return pageToMarkdown(client, nodes, buffer, notePath, 0)
+}
+
+func (obsidian) frontMatter(buffer *bufio.Writer, notePath string, page notion.Page, fields []frontMatterField) {
+	if fields == nil {
+		return
+	}
+	writeFrontMatter(buffer, fields)
+}
+
+func (obsidian) link(notePath, pageID, path, title string) string {
+	return pagePaths.link(pageID, title)
+}
+
+func (obsidian) externalLink(title, url string) string {
+	if *externalLinks == externalLinksNotion {
+		return fmt.Sprintf("[%s](%s)", escapeMarkdown(title, false), url)
+	}
+	return "[[" + strings.NewReplacer("|", "-", "[", "", "]", "", "#", "", "^", "").Replace(title) + "]]"
+}
+
+func (obsidian) reference(name string) string {
+	return "[[" + name + "]]"
+}
+
+func (obsidian) frontMatterLinks() bool {
+	return true
+}
+
+func (obsidian) callout(kind, title string, folded bool) string {
+	fold := ""
+	if folded {
+		fold = "-"
+	}
+	return fmt.Sprintf("> [!%s]%s %s", kind, fold, title)
+}
+
+func (obsidian) equation(expression string, block bool) string {
+	return "$$" + expression + "$$"
+}
+
+func (obsidian) placeholder(text string) string {
+	return "> [!warning] " + text
+}
+
+func (obsidian) headingLink(heading string) string {
+	// Obsidian does not allow these characters in heading links
+	heading = strings.NewReplacer("\\", "", "#", "", "|", "", "^", "", "[", "", "]", "").Replace(heading)
+	return "[[#" + strings.TrimSpace(heading) + "]]"
+}
+
+func (obsidian) delimiters(m mark) (string, string) {
+	switch m.kind {
+	case markColor:
+		return fmt.Sprintf(`<span style="color: %s">`, m.value), "</span>"
+	case markHighlight:
+		return "==", "=="
+	case markUnderline:
+		return "<u>", "</u>"
+	}
+	return "", ""
+}
+
+// logseq writes every block of the page as a bullet of an outline, with the
+// properties as key:: value pairs. Pages are linked by title.
+type logseq struct {
+	obsidian
+}
+
+func (logseq) writeBody(client client.NotionClient, nodes []*blockNode, buffer *bufio.Writer, notePath string) error {
+	for _, node := range nodes {
+		// Logseq has no table of contents
+		if _, ok := node.block.(*notion.TableOfContentsBlock); ok {
+			continue
+		}
+
+		b := &bytes.Buffer{}
+		blockBuffer := bufio.NewWriter(b)
+
+		if err := pageToMarkdown(client, []*blockNode{node}, blockBuffer, notePath, 0); err != nil {
+			return err
+		}
+		if err := blockBuffer.Flush(); err != nil {
+			return err
+		}
+
+		content := strings.Trim(b.String(), "\n")
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+
+		buffer.WriteString(outlineBlock(content))
+		buffer.WriteString("\n")
+	}
+
+	return nil
+}
+
+// outlineBlock turns the markdown of a top level block into a bullet. Lists
+// are already bullets, other blocks are nested under one.
+func outlineBlock(content string) string {
+	lines := strings.Split(content, "\n")
+
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimLeft(line, "\t"), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		// Tasks are bullets starting with their state
+		lines[i] = logseqTaskRegex.ReplaceAllStringFunc(line, func(task string) string {
+			match := logseqTaskRegex.FindStringSubmatch(task)
+			if match[2] == "x" {
+				return match[1] + "- DONE "
+			}
+			return match[1] + "- TODO "
+		})
+	}
+
+	if strings.HasPrefix(lines[0], "- ") {
+		return strings.Join(lines, "\n")
+	}
+
+	properties := []string{}
+	if numberedItemRegex.MatchString(lines[0]) {
+		lines[0] = numberedItemRegex.ReplaceAllString(lines[0], "")
+		properties = append(properties, "  logseq.order-list-type:: number")
+	}
+
+	result := []string{"- " + lines[0]}
+	result = append(result, properties...)
+	for _, line := range lines[1:] {
+		if line != "" {
+			line = "  " + line
+		}
+		result = append(result, line)
+	}
+
+	return strings.Join(result, "\n")
+}
+
+func (logseq) frontMatter(buffer *bufio.Writer, notePath string, page notion.Page, fields []frontMatterField) {
+	buffer.WriteString("title:: ")
+	buffer.WriteString(logseqValue(pageTitle(page)))
+	buffer.WriteString("\n")
+
+	for _, field := range fields {
+		key := strings.ToLower(logseqKeyReplacer.Replace(field.key))
+		if field.title || key == "title" || field.value == nil {
+			continue
+		}
+
+		var value string
+		if list, ok := field.value.([]interface{}); ok {
+			items := []string{}
+			for _, item := range list {
+				items = append(items, logseqValue(plainText(item)))
+			}
+			value = strings.Join(items, ", ")
+		} else {
+			value = logseqValue(plainText(field.value))
+		}
+
+		if value == "" {
+			continue
+		}
+
+		buffer.WriteString(key)
+		buffer.WriteString(":: ")
+		buffer.WriteString(value)
+		buffer.WriteString("\n")
+	}
+
+	buffer.WriteString("\n")
+}
+
+// logseqValue keeps the value of a property within its line.
+func logseqValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func (logseq) link(notePath, pageID, path, title string) string {
+	return "[[" + strings.NewReplacer("[", "", "]", "").Replace(title) + "]]"
+}
+
+func (logseq) callout(kind, title string, folded bool) string {
+	return commonMark{}.callout(kind, title, folded)
+}
+
+func (logseq) placeholder(text string) string {
+	return commonMark{}.placeholder(text)
+}
+
+func (logseq) headingLink(heading string) string {
+	return ""
+}
+
+// commonMark writes strict CommonMark with the GitHub extensions: relative
+// markdown links, quotes for callouts and HTML for the other annotations.
+type commonMark struct{}
+
+func (commonMark) writeBody(client client.NotionClient, nodes []*blockNode, buffer *bufio.Writer, notePath string) error {
+	return pageToMarkdown(client, nodes, buffer, notePath, 0)
+}
+
+func (commonMark) frontMatter(buffer *bufio.Writer, notePath string, page notion.Page, fields []frontMatterField) {
+	if fields == nil {
+		return
+	}
+	writeFrontMatter(buffer, fields)
+}
+
+func (commonMark) link(notePath, pageID, path, title string) string {
+	target, err := filepath.Rel(filepath.Dir(notePath), path)
+	if err != nil {
+		target = path
+	}
+	return fmt.Sprintf("[%s](%s)", escapeMarkdown(title, false), linkDestination(filepath.ToSlash(target)))
+}
+
+func (commonMark) externalLink(title, url string) string {
+	return fmt.Sprintf("[%s](%s)", escapeMarkdown(title, false), url)
+}
+
+func (commonMark) reference(name string) string {
+	return escapeMarkdown(name, false)
+}
+
+func (commonMark) frontMatterLinks() bool {
+	return false
+}
+
+func (commonMark) callout(kind, title string, folded bool) string {
+	if strings.TrimSpace(title) == "" {
+		return ""
+	}
+	return "> **" + strings.TrimSpace(title) + "**"
+}
+
+func (commonMark) equation(expression string, block bool) string {
+	if block {
+		return "```math\n" + expression + "\n```"
+	}
+	opener, closer := codeDelimiters(expression)
+	return opener + expression + closer
+}
+
+func (commonMark) placeholder(text string) string {
+	return "> **Warning:** " + text
+}
+
+func (commonMark) headingLink(heading string) string {
+	return fmt.Sprintf("[%s](#%s)", strings.TrimSpace(heading), headingSlug(heading))
+}
+
+// headingSlug returns the anchor GitHub and Hugo give to the heading.
+func headingSlug(heading string) string {
+	b := &strings.Builder{}
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+func (commonMark) delimiters(m mark) (string, string) {
+	switch m.kind {
+	case markColor:
+		return fmt.Sprintf(`<span style="color: %s">`, m.value), "</span>"
+	case markHighlight:
+		return "<mark>", "</mark>"
+	case markUnderline:
+		return "<u>", "</u>"
+	}
+	return "", ""
+}
+
+// hugo writes CommonMark for a Hugo site, the vault being its content folder.
+// Pages link to each other with relref and always have a front matter.
+type hugo struct {
+	commonMark
+	toml bool
+}
+
+func (h hugo) frontMatter(buffer *bufio.Writer, notePath string, page notion.Page, fields []frontMatterField) {
+	all := []frontMatterField{}
+	keys := map[string]bool{}
+	for _, field := range fields {
+		// The title property is written as the title of the page
+		if field.title {
+			continue
+		}
+		keys[field.key] = true
+		all = append(all, field)
+	}
+
+	defaults := []frontMatterField{{key: "title", value: pageTitle(page)}}
+	if !page.CreatedTime.IsZero() {
+		defaults = append(defaults, frontMatterField{key: "date", value: page.CreatedTime})
+	}
+	if !page.LastEditedTime.IsZero() {
+		defaults = append(defaults, frontMatterField{key: "lastmod", value: page.LastEditedTime})
+	}
+	for i := len(defaults) - 1; i >= 0; i-- {
+		if !keys[defaults[i].key] {
+			all = append([]frontMatterField{defaults[i]}, all...)
+		}
+	}
+
+	if h.toml {
+		writeTOMLFrontMatter(buffer, all)
+		return
+	}
+	writeFrontMatter(buffer, all)
+}
+
+func (hugo) link(notePath, pageID, path, title string) string {
+	target, err := filepath.Rel(*obsidianVault, path)
+	if err != nil {
+		target = path
+	}
+	return fmt.Sprintf(`[%s]({{< relref %q >}})`, escapeMarkdown(title, false), "/"+filepath.ToSlash(target))
+}
+
+func (hugo) delimiters(m mark) (string, string) {
+	// Hugo leaves out raw HTML unless the site allows it
+	return "", ""
+}
+
+func writeTOMLFrontMatter(buffer *bufio.Writer, fields []frontMatterField) {
+	buffer.WriteString("+++\n")
+	for _, field := range fields {
+		// TOML has no null, empty values are left out
+		if field.value == nil {
+			continue
+		}
+
+		buffer.WriteString(tomlKey(field.key))
+		buffer.WriteString(" = ")
+
+		if list, ok := field.value.([]interface{}); ok {
+			items := []string{}
+			for _, item := range list {
+				if item != nil {
+					items = append(items, tomlValue(item))
+				}
+			}
+			buffer.WriteString("[" + strings.Join(items, ", ") + "]")
+		} else {
+			buffer.WriteString(tomlValue(field.value))
+		}
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString("+++\n")
+}
+
+func tomlKey(key string) string {
+	if tomlBareKeyRegex.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+func tomlValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return tomlString(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan"
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		}
+		return plainText(v)
+	case bool, int, notion.DateTime, time.Time:
+		// Dates are local dates and date times for TOML
+		return plainText(v)
+	default:
+		return tomlString(plainText(v))
+	}
+}
+
+func tomlString(s string) string {
+	b := &strings.Builder{}
+	b.WriteString(`"`)
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case unicode.IsControl(r):
+			b.WriteString(fmt.Sprintf(`\u%04X`, r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString(`"`)
+	return b.String()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func TestRenderers_Link(t *testing.T) {
+	vault := *obsidianVault
+	*obsidianVault = "vault"
+	defer func() { *obsidianVault = vault }()
+
+	tests := []struct {
+		name     string
+		renderer renderer
+		expected string
+	}{
+		{"commonmark", commonMark{}, "[Plan (v2)](<../Archive/Plan (v2).md>)"},
+		{"hugo", hugo{}, `[Plan (v2)]({{< relref "/Archive/Plan (v2).md" >}})`},
+		{"logseq", logseq{}, "[[Plan (v2)]]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link := test.renderer.link("vault/Notes/note.md", "page", "vault/Archive/Plan (v2).md", "Plan (v2)")
+			if link != test.expected {
+				t.Errorf("incorrect link expected %q got: %q", test.expected, link)
+			}
+		})
+	}
+}
+
+func TestRenderers_Blocks(t *testing.T) {
+	blocks := `[` +
+		`{"object":"block","id":"callout","type":"callout","has_children":false,"callout":{"icon":{"type":"emoji","emoji":"💡"},"rich_text":[{"type":"text","text":{"content":"Tip"},"plain_text":"Tip","annotations":{"color":"default"}}]}},` +
+		`{"object":"block","id":"equation","type":"equation","equation":{"expression":"e=mc^2"}},` +
+		`{"object":"block","id":"highlight","type":"paragraph","paragraph":{"rich_text":[{"type":"text","text":{"content":"marked"},"plain_text":"marked","annotations":{"color":"yellow_background"}}]}},` +
+		`{"object":"block","id":"unsupported","type":"unsupported","unsupported":{}},` +
+		blockJSON("after", "paragraph", "after", false) +
+		`]`
+
+	tests := []struct {
+		name     string
+		renderer renderer
+		expected string
+	}{
+		{
+			"obsidian",
+			obsidian{},
+			"> [!tip] Tip\n" +
+				"\n" +
+				"$$e=mc^2$$\n" +
+				"==marked==\n" +
+				"> [!warning] Unsupported block: Unsupported\n" +
+				"\n" +
+				"after\n",
+		},
+		{
+			"commonmark",
+			commonMark{},
+			"> **Tip**\n" +
+				"\n" +
+				"```math\n" +
+				"e=mc^2\n" +
+				"```\n" +
+				"<mark>marked</mark>\n" +
+				"> **Warning:** Unsupported block: Unsupported\n" +
+				"\n" +
+				"after\n",
+		},
+		{
+			"hugo",
+			hugo{},
+			"> **Tip**\n" +
+				"\n" +
+				"```math\n" +
+				"e=mc^2\n" +
+				"```\n" +
+				"marked\n" +
+				"> **Warning:** Unsupported block: Unsupported\n" +
+				"\n" +
+				"after\n",
+		},
+	}
+
+	defer func() { output = obsidian{} }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output = test.renderer
+
+			result := renderBlocks(t, &client.Fake{}, blocksFromJSON(t, blocks))
+			if result != test.expected {
+				t.Errorf("incorrect result expected:\n%s\ngot:\n%s", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestLogseq_WriteBody(t *testing.T) {
+	output = logseq{}
+	defer func() { output = obsidian{} }()
+
+	fake := &client.Fake{
+		Blocks: map[string][]notion.Block{
+			"paragraph": blocksFromJSON(t, "["+blockJSON("child", "paragraph", "child text", false)+"]"),
+		},
+	}
+
+	blocks := blocksFromJSON(t, "["+
+		blockJSON("heading", "heading_1", "Overview", false)+","+
+		blockJSON("paragraph", "paragraph", "first line", true)+","+
+		`{"object":"block","id":"todo","type":"to_do","to_do":{"checked":true,"rich_text":[{"type":"text","text":{"content":"shipped"},"plain_text":"shipped","annotations":{"color":"default"}}]}},`+
+		blockJSON("numbered", "numbered_list_item", "step", false)+","+
+		`{"object":"block","id":"toc","type":"table_of_contents","table_of_contents":{}}`+
+		"]")
+
+	nodes, err := fetchDescendants(fake, blocks)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	b := &bytes.Buffer{}
+	buffer := bufio.NewWriter(b)
+	if err := output.writeBody(fake, nodes, buffer, "note.md"); err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	buffer.Flush()
+
+	expected := "- # Overview\n" +
+		"- first line\n" +
+		"  \tchild text\n" +
+		"- DONE shipped\n" +
+		"- step\n" +
+		"  logseq.order-list-type:: number\n"
+	if b.String() != expected {
+		t.Errorf("incorrect result expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestFrontMatter_Formats(t *testing.T) {
+	created := time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC)
+	page := notion.Page{
+		CreatedTime:    created,
+		LastEditedTime: created.Add(time.Hour),
+		Properties: notion.DatabasePageProperties{
+			"Name": notion.DatabasePageProperty{
+				Type:  notion.DBPropTypeTitle,
+				Title: []notion.RichText{{PlainText: "Launch: v2"}},
+			},
+		},
+	}
+	fields := []frontMatterField{
+		{key: "Name", value: "Launch: v2", title: true},
+		{key: "tags", value: []interface{}{"release", "q2"}},
+		{key: "due date", value: nil},
+	}
+
+	tests := []struct {
+		name     string
+		renderer renderer
+		expected string
+	}{
+		{
+			"hugo toml",
+			hugo{toml: true},
+			"+++\n" +
+				"title = \"Launch: v2\"\n" +
+				"date = 2023-04-05T10:30:00Z\n" +
+				"lastmod = 2023-04-05T11:30:00Z\n" +
+				"tags = [\"release\", \"q2\"]\n" +
+				"+++\n",
+		},
+		{
+			"logseq",
+			logseq{},
+			"title:: Launch: v2\n" +
+				"tags:: release, q2\n" +
+				"\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			buffer := bufio.NewWriter(b)
+			test.renderer.frontMatter(buffer, "vault/note.md", page, fields)
+			buffer.Flush()
+
+			if b.String() != test.expected {
+				t.Errorf("incorrect front matter expected:\n%s\ngot:\n%s", test.expected, b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+// markKind is a markdown annotation. At the same length, spans are opened in
+// this order, so the first kinds end up outermost.
+type markKind int
+
+const (
+	markColor markKind = iota
+	markHighlight
+	markUnderline
+	markStrikethrough
+	markBoldItalic
+	markBold
+	markItalic
+	markLink
+	markCode
+)
+
+type mark struct {
+	kind  markKind
+	value string
+}
+
+// span is a run of text sharing the same annotations. Literal text is
+// escaped, while links and mentions are written as they are.
+type span struct {
+	text    string
+	marks   []mark
+	literal bool
+}
+
+// openMark is a mark written to the output, waiting to be closed.
+type openMark struct {
+	mark
+	closer string
+}
+
+// writeRichText writes the rich text as markdown. Notion annotates each piece
+// of text on its own, so adjacent pieces sharing annotations are merged into
+// properly nested markdown.
+func writeRichText(client client.NotionClient, buffer *bufio.Writer, notePath string, richTextBlock []notion.RichText) error {
+	spans, err := richTextSpans(client, notePath, richTextBlock)
+	if err != nil {
+		return err
+	}
+
+	buffer.WriteString(renderSpans(spans))
+
+	return nil
+}
+
+func richTextSpans(client client.NotionClient, notePath string, richTextBlock []notion.RichText) ([]span, error) {
+	spans := []span{}
+
+	for _, text := range richTextBlock {
+		s := span{
+			marks: annotationMarks(text.Annotations),
+		}
+		code := hasMark(s.marks, mark{kind: markCode})
+
+		switch text.Type {
+		case notion.RichTextTypeText:
+			link := text.Text.Link
+			if link != nil && !code {
+				if strings.HasPrefix(link.URL, "/") {
+					// Link to internal Notion page
+					pageLink, err := pageLink(client, notePath, strings.TrimPrefix(link.URL, "/"), text.Text.Content)
+					if err != nil {
+						return nil, err
+					}
+					s.text = pageLink
+				} else {
+					s.text = text.Text.Content
+					s.literal = true
+					s.marks = append(s.marks, mark{kind: markLink, value: link.URL})
+				}
+			} else {
+				s.text = text.Text.Content
+				s.literal = !code
+			}
+		case notion.RichTextTypeMention:
+			switch text.Mention.Type {
+			case notion.MentionTypePage:
+				pageLink, err := pageLink(client, notePath, text.Mention.Page.ID, text.PlainText)
+				if err != nil {
+					return nil, err
+				}
+				s.text = pageLink
+			case notion.MentionTypeDatabase:
+				s.text = output.reference(text.PlainText)
+			case notion.MentionTypeDate:
+				s.text = output.reference(text.Mention.Date.Start.Format("2006-01-02"))
+			case notion.MentionTypeLinkPreview:
+				s.text = text.Mention.LinkPreview.URL
+			case notion.MentionTypeTemplateMention:
+			case notion.MentionTypeUser:
+			}
+		case notion.RichTextTypeEquation:
+			s.text = output.equation(text.Equation.Expression, false)
+		}
+
+		if s.text == "" {
+			continue
+		}
+
+		sort.Slice(s.marks, func(i, j int) bool {
+			return s.marks[i].kind < s.marks[j].kind
+		})
+		spans = append(spans, s)
+	}
+
+	return spans, nil
+}
+
+func annotationMarks(annotations *notion.Annotations) []mark {
+	marks := []mark{}
+	if annotations == nil {
+		return marks
+	}
+
+	if annotations.Bold {
+		marks = append(marks, mark{kind: markBold})
+	}
+	if annotations.Italic {
+		marks = append(marks, mark{kind: markItalic})
+	}
+	if annotations.Strikethrough {
+		marks = append(marks, mark{kind: markStrikethrough})
+	}
+	if annotations.Underline {
+		marks = append(marks, mark{kind: markUnderline})
+	}
+	if annotations.Code {
+		marks = append(marks, mark{kind: markCode})
+	}
+
+	// Background colors become highlights, text colors keep their color
+	color := string(annotations.Color)
+	if strings.HasSuffix(color, "_background") {
+		marks = append(marks, mark{kind: markHighlight})
+	} else if color != "" && annotations.Color != notion.ColorDefault {
+		marks = append(marks, mark{kind: markColor, value: color})
+	}
+
+	return marks
+}
+
+func renderSpans(spans []span) string {
+	b := &bytes.Buffer{}
+	open := []openMark{}
+
+	for i, s := range spans {
+		marks := s.marks
+		code := hasMark(marks, mark{kind: markCode})
+		if !code && strings.TrimSpace(s.text) == "" {
+			// Whitespace alone does not open annotations, it only continues them
+			marks = []mark{}
+			for _, o := range open {
+				if o.kind != markCode {
+					marks = append(marks, o.mark)
+				}
+			}
+		}
+
+		// Annotations are closed down to the first one not in this span
+		keep := 0
+		for keep < len(open) && hasMark(marks, open[keep].mark) {
+			keep++
+		}
+		// Nothing can be nested within code, so it is closed to open others
+		if keep > 0 && open[keep-1].kind == markCode {
+			for _, m := range marks {
+				if !covered(open[:keep], m) {
+					keep--
+					break
+				}
+			}
+		}
+		closeMarks(b, open[keep:])
+		open = open[:keep]
+
+		newMarks := []mark{}
+		for _, m := range marks {
+			if !covered(open, m) {
+				newMarks = append(newMarks, m)
+			}
+		}
+
+		newMarks = sortNewMarks(spans, i, newMarks)
+
+		text := s.text
+		if len(newMarks) > 0 && newMarks[0].kind != markCode {
+			// Annotations can not start with whitespace, so it goes before them
+			trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+			b.WriteString(text[:len(text)-len(trimmed)])
+			text = trimmed
+		}
+
+		for _, m := range newMarks {
+			opener, closer := markDelimiters(spans, i, m, b.Bytes())
+			b.WriteString(opener)
+			open = append(open, openMark{mark: m, closer: closer})
+		}
+
+		if s.literal {
+			text = escapeMarkdown(text, b.Len() == 0 || b.Bytes()[b.Len()-1] == '\n')
+			strikethrough := i+1 < len(spans) && hasMark(spans[i+1].marks, mark{kind: markStrikethrough})
+			for _, o := range open {
+				strikethrough = strikethrough || o.kind == markStrikethrough
+			}
+			text = escapeTildeEdges(text, b.Bytes(), strikethrough)
+		}
+
+		b.WriteString(text)
+	}
+
+	closeMarks(b, open)
+
+	return b.String()
+}
+
+// escapeTildeEdges escapes a single ~ at the edges of the text, which escapeMarkdown
+// leaves as it is, when it touches the ~~ of a strikethrough. ~~x~~~ would not
+// close the strikethrough otherwise.
+func escapeTildeEdges(text string, written []byte, strikethrough bool) string {
+	if strings.HasPrefix(text, "~") && bytes.HasSuffix(written, []byte("~")) {
+		text = "\\" + text
+	}
+
+	// The whitespace at the end goes after the closing ~~
+	trimmed := strings.TrimRightFunc(text, unicode.IsSpace)
+	if strikethrough && strings.HasSuffix(trimmed, "~") && !escaped(trimmed, len(trimmed)-1) {
+		text = trimmed[:len(trimmed)-1] + "\\~" + text[len(trimmed):]
+	}
+
+	return text
+}
+
+// escaped reports whether the character at i is preceded by an odd number of
+// backslashes.
+func escaped(text string, i int) bool {
+	backslashes := 0
+	for i > 0 && text[i-1] == '\\' {
+		backslashes++
+		i--
+	}
+	return backslashes%2 == 1
+}
+
+// closeMarks closes the annotations from the innermost one. Annotations can
+// not end with whitespace, so it goes after them.
+func closeMarks(b *bytes.Buffer, open []openMark) {
+	whitespace := ""
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i].kind != markCode {
+			content := b.String()
+			trimmed := strings.TrimRightFunc(content, unicode.IsSpace)
+			whitespace = content[len(trimmed):] + whitespace
+			b.Truncate(len(trimmed))
+		}
+		b.WriteString(open[i].closer)
+	}
+	b.WriteString(whitespace)
+}
+
+// sortNewMarks orders the annotations opened at span i so the longest ones
+// are outermost. Bold and italic of the same length are merged into ***.
+func sortNewMarks(spans []span, i int, marks []mark) []mark {
+	length := map[mark]int{}
+	for _, m := range marks {
+		length[m] = runLength(spans, i, m)
+	}
+
+	bold, italic := mark{kind: markBold}, mark{kind: markItalic}
+	if _, ok := length[bold]; ok {
+		if _, ok := length[italic]; ok && length[bold] == length[italic] {
+			merged := []mark{}
+			for _, m := range marks {
+				if m != bold && m != italic {
+					merged = append(merged, m)
+				}
+			}
+			boldItalic := mark{kind: markBoldItalic}
+			length[boldItalic] = length[bold]
+			marks = append(merged, boldItalic)
+		}
+	}
+
+	sort.SliceStable(marks, func(a, b int) bool {
+		// Code is always innermost as nothing can be nested within it
+		if (marks[a].kind == markCode) != (marks[b].kind == markCode) {
+			return marks[b].kind == markCode
+		}
+		if length[marks[a]] != length[marks[b]] {
+			return length[marks[a]] > length[marks[b]]
+		}
+		return marks[a].kind < marks[b].kind
+	})
+
+	return marks
+}
+
+// runLength returns the number of spans from i annotated with m. Spans with
+// only whitespace continue any annotation.
+func runLength(spans []span, i int, m mark) int {
+	n := 0
+	for j := i; j < len(spans); j++ {
+		if !hasMark(spans[j].marks, m) && (m.kind == markCode || strings.TrimSpace(spans[j].text) != "") {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+func markDelimiters(spans []span, i int, m mark, written []byte) (string, string) {
+	switch m.kind {
+	case markColor, markHighlight, markUnderline:
+		return output.delimiters(m)
+	case markStrikethrough:
+		return "~~", "~~"
+	case markBoldItalic:
+		return "***", "***"
+	case markBold:
+		return "**", "**"
+	case markItalic:
+		// Underscores do not work within words
+		end := i + runLength(spans, i, m)
+		if endsWithWordCharacter(written) || (end < len(spans) && startsWithWordCharacter(spans[end].text)) {
+			return "*", "*"
+		}
+		return "_", "_"
+	case markLink:
+		return "[", "](" + m.value + ")"
+	case markCode:
+		content := ""
+		for j := i; j < i+runLength(spans, i, m); j++ {
+			content += spans[j].text
+		}
+		return codeDelimiters(content)
+	}
+
+	return "", ""
+}
+
+// codeDelimiters returns a backtick string longer than any within content.
+func codeDelimiters(content string) (string, string) {
+	longest, current := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			current++
+			if current > longest {
+				longest = current
+			}
+		} else {
+			current = 0
+		}
+	}
+
+	delimiter := strings.Repeat("`", longest+1)
+	if longest > 0 {
+		return delimiter + " ", " " + delimiter
+	}
+	return delimiter, delimiter
+}
+
+// hasMark reports whether the span marks include m.
+func hasMark(marks []mark, m mark) bool {
+	for _, other := range marks {
+		if other == m {
+			return true
+		}
+	}
+
+	if m.kind == markBoldItalic {
+		return hasMark(marks, mark{kind: markBold}) && hasMark(marks, mark{kind: markItalic})
+	}
+
+	return false
+}
+
+// covered reports whether m is already open.
+func covered(open []openMark, m mark) bool {
+	for _, o := range open {
+		if o.mark == m {
+			return true
+		}
+		if o.kind == markBoldItalic && (m.kind == markBold || m.kind == markItalic) {
+			return true
+		}
+	}
+	return false
+}
+
+func endsWithWordCharacter(b []byte) bool {
+	r, _ := utf8.DecodeLastRune(b)
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func startsWithWordCharacter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+var (
+	bareURLRegex     = regexp.MustCompile(`https?://[^\s<>()\[\]]+`)
+	orderedListRegex = regexp.MustCompile(`^[0-9]{1,9}[.)]`)
+)
+
+// escapeMarkdown escapes the characters of plain text that Obsidian would read
+// as formatting, links, tags or comments. Block markers are only escaped at
+// the start of a line, and bare URLs are left as they are so they stay links.
+func escapeMarkdown(text string, lineStart bool) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = escapeLine(line, i > 0 || lineStart)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func escapeLine(line string, lineStart bool) string {
+	b := &strings.Builder{}
+
+	if lineStart {
+		trimmed := strings.TrimLeft(line, " ")
+		b.WriteString(line[:len(line)-len(trimmed)])
+		line = trimmed
+
+		switch {
+		case strings.HasPrefix(line, "#"), strings.HasPrefix(line, ">"), strings.HasPrefix(line, "-"), strings.HasPrefix(line, "+"):
+			// The character is escaped below when it is not already
+			if line[0] != '#' {
+				b.WriteString("\\")
+			}
+		case orderedListRegex.MatchString(line):
+			marker := orderedListRegex.FindString(line)
+			b.WriteString(marker[:len(marker)-1])
+			b.WriteString("\\")
+			b.WriteString(marker[len(marker)-1:])
+			line = line[len(marker):]
+		}
+	}
+
+	urls := bareURLRegex.FindAllStringIndex(line, -1)
+	runes := []rune(line)
+	offset := 0
+	for i, r := range runes {
+		position := offset
+		offset += utf8.RuneLen(r)
+
+		if inRanges(urls, position) {
+			b.WriteRune(r)
+			continue
+		}
+
+		previous, next := rune(0), rune(0)
+		if i > 0 {
+			previous = runes[i-1]
+		}
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch r {
+		case '\\', '*', '_', '`', '[', ']', '$':
+			b.WriteRune('\\')
+		case '~', '=', '%':
+			// Only doubled they mean strikethrough, highlight or comment. A
+			// line of = also turns the previous one into a heading.
+			if previous == r || next == r || (r == '=' && lineStart && strings.Trim(line, "=") == "") {
+				b.WriteRune('\\')
+			}
+		case '#':
+			// Tags and headings
+			if (i == 0 && lineStart) || (next != 0 && !unicode.IsSpace(next)) {
+				b.WriteRune('\\')
+			}
+		case '<':
+			// HTML tags
+			if unicode.IsLetter(next) || next == '/' || next == '!' || next == '?' {
+				b.WriteRune('\\')
+			}
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func inRanges(ranges [][]int, position int) bool {
+	for _, r := range ranges {
+		if position >= r[0] && position < r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func annotatedText(content string, annotations notion.Annotations) notion.RichText {
+	if annotations.Color == "" {
+		annotations.Color = notion.ColorDefault
+	}
+
+	return notion.RichText{
+		Type:        notion.RichTextTypeText,
+		Annotations: &annotations,
+		Text:        &notion.Text{Content: content},
+		PlainText:   content,
+	}
+}
+
+func linkedText(content, url string, annotations notion.Annotations) notion.RichText {
+	text := annotatedText(content, annotations)
+	text.Text.Link = &notion.Link{URL: url}
+	return text
+}
+
+func TestWriteRichText_SpanMerging(t *testing.T) {
+	tests := []struct {
+		name     string
+		richText []notion.RichText
+		expected string
+	}{
+		{
+			name:     "empty",
+			richText: nil,
+			expected: "",
+		},
+		{
+			name: "plain text",
+			richText: []notion.RichText{
+				annotatedText("hello ", notion.Annotations{}),
+				annotatedText("world", notion.Annotations{}),
+			},
+			expected: "hello world",
+		},
+		{
+			name: "whitespace moved out of annotations",
+			richText: []notion.RichText{
+				annotatedText("a", notion.Annotations{}),
+				annotatedText(" bold ", notion.Annotations{Bold: true}),
+				annotatedText("c", notion.Annotations{}),
+			},
+			expected: "a **bold** c",
+		},
+		{
+			name: "whitespace only does not open annotations",
+			richText: []notion.RichText{
+				annotatedText("a", notion.Annotations{}),
+				annotatedText(" ", notion.Annotations{Bold: true}),
+				annotatedText("b", notion.Annotations{}),
+			},
+			expected: "a b",
+		},
+		{
+			name: "whitespace continues annotations",
+			richText: []notion.RichText{
+				annotatedText("a", notion.Annotations{Bold: true}),
+				annotatedText(" ", notion.Annotations{}),
+				annotatedText("b", notion.Annotations{Bold: true}),
+			},
+			expected: "**a b**",
+		},
+		{
+			name: "tilde at the end of a strikethrough",
+			richText: []notion.RichText{
+				annotatedText("x~ ", notion.Annotations{Strikethrough: true}),
+				annotatedText("y", notion.Annotations{}),
+			},
+			expected: "~~x\\~~~ y",
+		},
+		{
+			name: "tilde at the start of a strikethrough",
+			richText: []notion.RichText{
+				annotatedText("~x", notion.Annotations{Strikethrough: true}),
+			},
+			expected: "~~\\~x~~",
+		},
+		{
+			name: "tilde around a strikethrough",
+			richText: []notion.RichText{
+				annotatedText("about~", notion.Annotations{}),
+				annotatedText("x", notion.Annotations{Strikethrough: true}),
+				annotatedText("~5", notion.Annotations{}),
+			},
+			expected: "about\\~~~x~~\\~5",
+		},
+		{
+			name: "annotation characters within content are escaped",
+			richText: []notion.RichText{
+				annotatedText("2*3_", notion.Annotations{Bold: true}),
+				annotatedText("~~", notion.Annotations{Bold: true, Strikethrough: true}),
+			},
+			expected: "**2\\*3\\_~~\\~\\~~~**",
+		},
+		{
+			name: "longest annotation is outermost",
+			richText: []notion.RichText{
+				annotatedText("a ", notion.Annotations{Italic: true}),
+				annotatedText("b ", notion.Annotations{Italic: true, Strikethrough: true}),
+				annotatedText("c", notion.Annotations{Italic: true, Strikethrough: true, Bold: true}),
+			},
+			expected: "_a ~~b **c**~~_",
+		},
+		{
+			name: "overlapping annotations",
+			richText: []notion.RichText{
+				annotatedText("a ", notion.Annotations{Bold: true}),
+				annotatedText("b", notion.Annotations{Bold: true, Strikethrough: true}),
+				annotatedText(" c", notion.Annotations{Strikethrough: true}),
+			},
+			expected: "**a ~~b~~** ~~c~~",
+		},
+		{
+			name: "bold and italic together",
+			richText: []notion.RichText{
+				annotatedText("both", notion.Annotations{Bold: true, Italic: true}),
+				annotatedText(" bold", notion.Annotations{Bold: true}),
+			},
+			expected: "**_both_ bold**",
+		},
+		{
+			name: "italic within a word",
+			richText: []notion.RichText{
+				annotatedText("foo", notion.Annotations{}),
+				annotatedText("bar", notion.Annotations{Italic: true}),
+			},
+			expected: "foo*bar*",
+		},
+		{
+			name: "underline",
+			richText: []notion.RichText{
+				annotatedText("under", notion.Annotations{Underline: true}),
+				annotatedText("line", notion.Annotations{Underline: true, Bold: true}),
+			},
+			expected: "<u>under**line**</u>",
+		},
+		{
+			name: "background color",
+			richText: []notion.RichText{
+				annotatedText("highlight", notion.Annotations{Color: notion.ColorYellowBg}),
+			},
+			expected: "==highlight==",
+		},
+		{
+			name: "text color",
+			richText: []notion.RichText{
+				annotatedText("red", notion.Annotations{Color: notion.ColorRed, Bold: true}),
+			},
+			expected: "<span style=\"color: red\">**red**</span>",
+		},
+		{
+			name: "link across annotations",
+			richText: []notion.RichText{
+				linkedText("foo ", "https://example.com", notion.Annotations{}),
+				linkedText("bar", "https://example.com", notion.Annotations{Bold: true}),
+			},
+			expected: "[foo **bar**](https://example.com)",
+		},
+		{
+			name: "adjacent links",
+			richText: []notion.RichText{
+				linkedText("foo", "https://foo.com", notion.Annotations{}),
+				linkedText("bar", "https://bar.com", notion.Annotations{}),
+			},
+			expected: "[foo](https://foo.com)[bar](https://bar.com)",
+		},
+		{
+			name: "code with backticks",
+			richText: []notion.RichText{
+				annotatedText("a`b", notion.Annotations{Code: true}),
+			},
+			expected: "`` a`b ``",
+		},
+		{
+			name: "annotation opened within code",
+			richText: []notion.RichText{
+				annotatedText("a", notion.Annotations{Code: true}),
+				annotatedText("b", notion.Annotations{Code: true, Bold: true}),
+			},
+			expected: "`a`**`b`**",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			buffer := bufio.NewWriter(b)
+
+			if err := writeRichText(nil, buffer, "vault/note.md", test.richText); err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+
+			if err := buffer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if result := b.String(); result != test.expected {
+				t.Errorf("incorrect result expected '%s' got: '%s'", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := []struct {
+		text      string
+		lineStart bool
+		expected  string
+	}{
+		{"*not bold*", true, "\\*not bold\\*"},
+		{"[brackets] and [[link]]", true, "\\[brackets\\] and \\[\\[link\\]\\]"},
+		{"# not a heading", true, "\\# not a heading"},
+		{"# in the middle", false, "# in the middle"},
+		{"a #tag and a # sign", false, "a \\#tag and a # sign"},
+		{"1. not a list", true, "1\\. not a list"},
+		{"1. in the middle", false, "1. in the middle"},
+		{"first\n- second\n> third", false, "first\n\\- second\n\\> third"},
+		{"  + indented", true, "  \\+ indented"},
+		{"title\n===", false, "title\n\\=\\=\\="},
+		{"title\n=", false, "title\n\\="},
+		{"~5 minutes, ~~not struck~~", false, "~5 minutes, \\~\\~not struck\\~\\~"},
+		{"==not highlighted== a=b", false, "\\=\\=not highlighted\\=\\= a=b"},
+		{"%%not a comment%% 5%", false, "\\%\\%not a comment\\%\\% 5%"},
+		{"costs $5 and $10", false, "costs \\$5 and \\$10"},
+		{"a <div> and 1 < 2", false, "a \\<div> and 1 < 2"},
+		{"see https://example.com/a_b_c for `code`", false, "see https://example.com/a_b_c for \\`code\\`"},
+		{"back\\slash", false, "back\\\\slash"},
+	}
+
+	for _, test := range tests {
+		if result := escapeMarkdown(test.text, test.lineStart); result != test.expected {
+			t.Errorf("incorrect escaping of %q expected %q got: %q", test.text, test.expected, result)
+		}
+	}
+}
+
+func TestWriteRichText_EscapingSkipsCode(t *testing.T) {
+	b := &bytes.Buffer{}
+	buffer := bufio.NewWriter(b)
+
+	richText := []notion.RichText{
+		annotatedText("*a* ", notion.Annotations{}),
+		annotatedText("*b*", notion.Annotations{Code: true}),
+		linkedText(" [c]", "https://example.com/*", notion.Annotations{}),
+	}
+
+	if err := writeRichText(nil, buffer, "vault/note.md", richText); err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	if err := buffer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "\\*a\\* `*b*` [\\[c\\]](https://example.com/*)"
+	if result := b.String(); result != expected {
+		t.Errorf("incorrect result expected '%s' got: '%s'", expected, result)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+const (
+	siteIndexFile  = "index.html"
+	siteStyleFile  = "style.css"
+	siteSearchFile = "search.json"
+
+	// siteIndexID reserves the path of the index, so no page is written there
+	siteIndexID = "site-index"
+)
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// searchEntry is a page of the search index of the site.
+type searchEntry struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Text  string `json:"text"`
+}
+
+// siteRow is a page listed in the index of the site.
+type siteRow struct {
+	title  string
+	href   string
+	values map[string]string
+}
+
+// writeSite writes the index of the site, a table of the pages with the
+// properties of the -id database, along with the style sheet and the search
+// index. Pages are read back from the vault, so the pages left unchanged by
+// this run are listed too.
+func writeSite(client client.NotionClient, title string, pages []notion.Page, pagePropertiesToInclude, pagePropertiesToSkip map[string]bool) error {
+	indexPath := filepath.Join(*obsidianVault, siteIndexFile)
+
+	rows := []siteRow{}
+	columns := map[string]bool{}
+	entries := []searchEntry{}
+
+	for _, page := range pages {
+		notePath, ok := pagePaths.pathOf(page.ID)
+		if !ok {
+			continue
+		}
+
+		content, err := os.ReadFile(notePath)
+		if err != nil {
+			// Pages that failed to migrate are left out
+			continue
+		}
+
+		relative, err := filepath.Rel(*obsidianVault, notePath)
+		if err != nil {
+			return fmt.Errorf("failed to find the URL of page %s. error: %w", page.ID, err)
+		}
+
+		entries = append(entries, searchEntry{
+			Title: pageTitle(page),
+			URL:   relativeURL(relative),
+			Text:  pageText(string(content)),
+		})
+
+		row := siteRow{title: pageTitle(page), href: htmlHref(relative), values: map[string]string{}}
+
+		if page.Parent.Type == notion.ParentTypeDatabase && page.Parent.DatabaseID == *databaseID {
+			props, _ := page.Properties.(notion.DatabasePageProperties)
+			for name, prop := range props {
+				if prop.Type == notion.DBPropTypeTitle {
+					continue
+				}
+				if len(pagePropertiesToInclude) > 0 && !pagePropertiesToInclude[strings.ToLower(name)] {
+					continue
+				}
+				if pagePropertiesToSkip[strings.ToLower(name)] {
+					continue
+				}
+
+				value, ok, err := propertyValue(client, prop, indexPath)
+				if err != nil {
+					return fmt.Errorf("failed to convert property %s. error: %w", name, err)
+				}
+				if ok && value != nil {
+					columns[name] = true
+					row.values[name] = htmlValue(value)
+				}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return strings.ToLower(rows[i].title) < strings.ToLower(rows[j].title)
+	})
+
+	names := []string{}
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := &bytes.Buffer{}
+	buffer := bufio.NewWriter(b)
+
+	writeHTMLHead(buffer, indexPath, html.EscapeString(title))
+	buffer.WriteString("<main>\n")
+	buffer.WriteString("<h1>" + html.EscapeString(title) + "</h1>\n")
+	buffer.WriteString("<input id=\"search\" type=\"search\" placeholder=\"Search\">\n")
+	buffer.WriteString("<ul id=\"results\"></ul>\n")
+	buffer.WriteString("<table class=\"index\">\n<tr><th>Title</th>")
+	for _, name := range names {
+		buffer.WriteString("<th>" + html.EscapeString(name) + "</th>")
+	}
+	buffer.WriteString("</tr>\n")
+	for _, row := range rows {
+		buffer.WriteString(fmt.Sprintf("<tr><td><a href=\"%s\">%s</a></td>", row.href, html.EscapeString(row.title)))
+		for _, name := range names {
+			buffer.WriteString("<td>" + row.values[name] + "</td>")
+		}
+		buffer.WriteString("</tr>\n")
+	}
+	buffer.WriteString("</table>\n")
+	buffer.WriteString("</main>\n")
+	buffer.WriteString("<script>\n" + siteSearchScript + "</script>\n")
+	buffer.WriteString("</body>\n</html>\n")
+
+	if err := buffer.Flush(); err != nil {
+		return fmt.Errorf("failed to render the index of the site. error: %w", err)
+	}
+
+	if err := os.WriteFile(indexPath, b.Bytes(), 0666); err != nil {
+		return fmt.Errorf("failed to write the index of the site. error: %w", err)
+	}
+
+	search, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode the search index. error: %w", err)
+	}
+
+	if err = os.WriteFile(filepath.Join(*obsidianVault, siteSearchFile), search, 0666); err != nil {
+		return fmt.Errorf("failed to write the search index. error: %w", err)
+	}
+
+	if err = os.WriteFile(filepath.Join(*obsidianVault, siteStyleFile), []byte(siteStyle), 0666); err != nil {
+		return fmt.Errorf("failed to write the style sheet. error: %w", err)
+	}
+
+	return nil
+}
+
+// siteTitle returns the title of the index: the migrated database, the root
+// of the migrated page tree or the workspace.
+func siteTitle(client client.NotionClient, pages []notion.Page) string {
+	switch *mode {
+	case modeDatabase:
+		db, err := client.FindDatabaseByID(context.Background(), *databaseID)
+		if err == nil && extractPlainTextFromRichText(db.Title) != "" {
+			return extractPlainTextFromRichText(db.Title)
+		}
+	case modePage:
+		// The page tree is discovered from its root
+		if len(pages) > 0 {
+			return pageTitle(pages[0])
+		}
+	}
+
+	return "Index"
+}
+
+// pageText returns the text of the page for the search index.
+func pageText(content string) string {
+	if start := strings.Index(content, "<main>"); start >= 0 {
+		content = content[start:]
+	}
+	if end := strings.LastIndex(content, "</main>"); end >= 0 {
+		content = content[:end]
+	}
+
+	content = html.UnescapeString(htmlTagRegex.ReplaceAllString(content, " "))
+
+	return strings.Join(strings.Fields(content), " ")
+}
+
+// siteSearchScript searches the pages of search.json as the query is typed.
+// Browsers only fetch it when the site is served over HTTP.
+const siteSearchScript = `const input = document.getElementById("search");
+const results = document.getElementById("results");
+let pages = null;
+
+input.addEventListener("input", async () => {
+  if (pages === null) {
+    pages = await (await fetch("search.json")).json();
+  }
+
+  const terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+  results.replaceChildren();
+
+  for (const page of terms.length > 0 ? pages : []) {
+    const text = (page.title + " " + page.text).toLowerCase();
+    if (terms.every((term) => text.includes(term))) {
+      const item = document.createElement("li");
+      const link = document.createElement("a");
+      link.href = page.url;
+      link.textContent = page.title;
+      item.append(link);
+      results.append(item);
+    }
+  }
+});
+`
+
+const siteStyle = `body {
+  font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif;
+  line-height: 1.6;
+  color: #37352f;
+  margin: 0 auto;
+  max-width: 52rem;
+  padding: 1rem 2rem;
+}
+
+table {
+  border-collapse: collapse;
+  margin: 1rem 0;
+}
+
+th, td {
+  border: 1px solid #e9e9e7;
+  padding: 0.25rem 0.5rem;
+  text-align: left;
+  vertical-align: top;
+}
+
+pre {
+  background: #f7f6f3;
+  overflow-x: auto;
+  padding: 1rem;
+}
+
+code {
+  background: #f7f6f3;
+  padding: 0 0.2rem;
+}
+
+blockquote {
+  border-left: 3px solid #37352f;
+  margin: 0;
+  padding-left: 1rem;
+}
+
+img, video {
+  max-width: 100%;
+}
+
+figure {
+  margin: 1rem 0;
+}
+
+.callout {
+  background: #f1f1ef;
+  border-radius: 4px;
+  padding: 0.5rem 1rem;
+}
+
+.columns {
+  display: flex;
+  gap: 1.5rem;
+}
+
+.column {
+  flex: 1;
+}
+
+.indented {
+  padding-left: 1.5rem;
+}
+
+.todo {
+  list-style: none;
+  padding-left: 0.5rem;
+}
+
+.toc-2 {
+  margin-left: 1rem;
+}
+
+.toc-3 {
+  margin-left: 2rem;
+}
+
+.equation {
+  font-family: serif;
+  font-style: italic;
+}
+
+#search {
+  font: inherit;
+  padding: 0.25rem 0.5rem;
+  width: 100%;
+}
+`
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func TestWriteSite(t *testing.T) {
+	vault, paths, id, selected, renderer, extension, store := *obsidianVault, pagePaths, *databaseID, *format, output, noteExtension, attachmentStore
+	defer func() {
+		*obsidianVault, pagePaths, *databaseID, *format, output, noteExtension, attachmentStore = vault, paths, id, selected, renderer, extension, store
+	}()
+
+	*obsidianVault = t.TempDir()
+	*databaseID = "projects"
+	*format = formatHTML
+	output = htmlSite{}
+	noteExtension = ".html"
+	attachmentStore = nil
+
+	var err error
+	if pagePaths, err = newNotePaths(*obsidianVault, collisionSuffix, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	website := "https://example.com/launch"
+	launch := notion.Page{
+		ID:     "launch",
+		Parent: notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: "projects"},
+		Properties: notion.DatabasePageProperties{
+			"Name":   {Type: notion.DBPropTypeTitle, Title: []notion.RichText{{PlainText: "Launch <v2>"}}},
+			"Status": {Type: notion.DBPropTypeSelect, Select: &notion.SelectOptions{Name: "Done"}},
+			"Files": {Type: notion.DBPropTypeFiles, Files: []notion.File{
+				{Name: "Brief [v1]", Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: "https://example.com/brief.pdf?a=1&b=2"}},
+			}},
+			"Website": {Type: notion.DBPropTypeURL, URL: &website},
+		},
+	}
+	notes := titledPage("notes", notion.Parent{Type: notion.ParentTypePage, PageID: "launch"}, "Meeting: notes")
+
+	fake := &client.Fake{
+		Databases: map[string]notion.Database{
+			"projects": {ID: "projects", Title: []notion.RichText{{PlainText: "Projects"}}},
+		},
+		Blocks: map[string][]notion.Block{
+			"launch": blocksFromJSON(t, `[{"object":"block","id":"notes","type":"child_page","child_page":{"title":"Meeting: notes"}}]`),
+			"notes": blocksFromJSON(t, "["+
+				`{"object":"block","id":"toc","type":"table_of_contents","table_of_contents":{}},`+
+				blockJSON("heading", "heading_1", "Overview", false)+","+
+				blockJSON("first", "bulleted_list_item", "one", false)+","+
+				blockJSON("second", "bulleted_list_item", "two & three", false)+","+
+				`{"object":"block","id":"mention","type":"paragraph","paragraph":{"rich_text":[{"type":"mention","mention":{"type":"page","page":{"id":"launch"}},"plain_text":"Launch","annotations":{"bold":true,"color":"default"}}]}}`+
+				"]"),
+		},
+	}
+
+	pages := []notion.Page{launch, notes}
+	for _, page := range pages {
+		if _, err = pagePaths.assign(page.ID, filepath.Join(*obsidianVault, sanitizeFileName(pageTitle(page))+noteExtension)); err != nil {
+			t.Fatal(err)
+		}
+		pagePaths.setTitle(page.ID, pageTitle(page))
+	}
+
+	for _, page := range pages {
+		path, _ := pagePaths.pathOf(page.ID)
+		dbPage := page.Parent.Type == notion.ParentTypeDatabase
+		if err = fetchAndSaveToObsidianVault(fake, page, map[string]bool{}, map[string]bool{}, path, dbPage); err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+	}
+
+	if err = writeSite(fake, "Projects", pages, map[string]bool{}, map[string]bool{}); err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(*obsidianVault, name))
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+		return string(content)
+	}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"Launch v2.html", "<tr><th>Status</th><td>Done</td></tr>"},
+		{"Launch v2.html", `<tr><th>Files</th><td><a href="https://example.com/brief.pdf?a=1&amp;b=2">Brief [v1]</a></td></tr>`},
+		{"Launch v2.html", `<tr><th>Website</th><td><a href="https://example.com/launch">https://example.com/launch</a></td></tr>`},
+		{"Launch v2.html", `<p class="page"><a href="Meeting-%20notes.html">Meeting: notes</a></p>`},
+		{"Meeting- notes.html", `<link rel="stylesheet" href="style.css">`},
+		{"Meeting- notes.html", "<nav class=\"toc\">\n<ul>\n<li class=\"toc-1\"><a href=\"#overview\">Overview</a></li>\n</ul>\n</nav>\n"},
+		{"Meeting- notes.html", "<h2 id=\"overview\">Overview</h2>\n<ul>\n<li>one</li>\n<li>two &amp; three</li>\n</ul>\n"},
+		{"Meeting- notes.html", `<p><strong><a href="Launch%20v2.html">Launch &lt;v2&gt;</a></strong></p>`},
+		{"index.html", "<tr><th>Title</th><th>Files</th><th>Status</th><th>Website</th></tr>"},
+		{"index.html", `<tr><td><a href="Launch%20v2.html">Launch &lt;v2&gt;</a></td><td><a href="https://example.com/brief.pdf?a=1&amp;b=2">Brief [v1]</a></td><td>Done</td><td><a href="https://example.com/launch">https://example.com/launch</a></td></tr>`},
+		{"index.html", `<tr><td><a href="Meeting-%20notes.html">Meeting: notes</a></td><td></td><td></td><td></td></tr>`},
+	}
+
+	for _, test := range tests {
+		if content := read(test.file); !strings.Contains(content, test.expected) {
+			t.Errorf("incorrect %s expected to contain:\n%s\ngot:\n%s", test.file, test.expected, content)
+		}
+	}
+
+	entries := []searchEntry{}
+	if err = json.Unmarshal([]byte(read(siteSearchFile)), &entries); err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	expected := []searchEntry{
+		{Title: "Launch <v2>", URL: "Launch%20v2.html", Text: "Launch <v2> Files Brief [v1] Status Done Website https://example.com/launch Meeting: notes"},
+		{Title: "Meeting: notes", URL: "Meeting-%20notes.html", Text: "Meeting: notes Overview Overview one two & three Launch <v2>"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("incorrect search entries expected %d got: %d", len(expected), len(entries))
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("incorrect search entry expected %+v got: %+v", expected[i], entries[i])
+		}
+	}
+}
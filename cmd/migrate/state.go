@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const stateFileName = ".notion_migrate_state.json"
+
+// syncState is stored in the vault to only migrate the pages that changed
+// since the previous run.
+type syncState struct {
+	Databases map[string]databaseState `json:"databases"`
+	Pages     map[string]pageState     `json:"pages"`
+	// Children holds the sub pages and databases found in the blocks of the
+	// pages, so the pages that did not change are not fetched to find them
+	Children map[string]pageChildren `json:"children,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+type databaseState struct {
+	LastSync time.Time `json:"last_sync"`
+}
+
+type pageChildren struct {
+	Pages     []string `json:"pages,omitempty"`
+	Databases []string `json:"databases,omitempty"`
+}
+
+type pageState struct {
+	LastEditedTime time.Time `json:"last_edited_time"`
+	Path           string    `json:"path"`
+	Title          string    `json:"title,omitempty"`
+}
+
+func loadSyncState(vault string) (*syncState, error) {
+	state := &syncState{
+		Databases: map[string]databaseState{},
+		Pages:     map[string]pageState{},
+		Children:  map[string]pageChildren{},
+		path:      filepath.Join(vault, stateFileName),
+	}
+
+	content, err := os.ReadFile(state.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read sync state %s. error: %w", state.path, err)
+	}
+
+	if err = json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state %s. error: %w", state.path, err)
+	}
+
+	if state.Databases == nil {
+		state.Databases = map[string]databaseState{}
+	}
+	if state.Pages == nil {
+		state.Pages = map[string]pageState{}
+	}
+	if state.Children == nil {
+		state.Children = map[string]pageChildren{}
+	}
+
+	return state, nil
+}
+
+// lastSync returns when the database was last migrated without errors.
+func (s *syncState) lastSync(databaseID string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	db, ok := s.Databases[databaseID]
+	return db.LastSync, ok
+}
+
+func (s *syncState) setLastSync(databaseID string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Databases[databaseID] = databaseState{LastSync: t}
+}
+
+// unchanged reports whether the page was already written to path with the
+// same last edited time.
+func (s *syncState) unchanged(pageID string, lastEditedTime time.Time, path string) bool {
+	s.mu.Lock()
+	page, ok := s.Pages[pageID]
+	s.mu.Unlock()
+
+	if !ok || !page.LastEditedTime.Equal(lastEditedTime) || page.Path != path {
+		return false
+	}
+
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// knownChildren returns the sub pages and databases of the page when it was
+// migrated with the same last edited time and its file is still in the vault.
+func (s *syncState) knownChildren(pageID string, lastEditedTime time.Time) (pageChildren, bool) {
+	s.mu.Lock()
+	page, migrated := s.Pages[pageID]
+	children, ok := s.Children[pageID]
+	s.mu.Unlock()
+
+	if !migrated || !ok || !page.LastEditedTime.Equal(lastEditedTime) {
+		return pageChildren{}, false
+	}
+
+	if _, err := os.Stat(page.Path); err != nil {
+		return pageChildren{}, false
+	}
+	return children, true
+}
+
+func (s *syncState) setChildren(pageID string, children pageChildren) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Children[pageID] = children
+}
+
+// setPage records a migrated page. It returns the previous path of the page
+// when the page was written somewhere else before. The title is kept to link
+// to the page on the next runs, even when it is not migrated again.
+func (s *syncState) setPage(pageID string, lastEditedTime time.Time, path, title string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.Pages[pageID]
+	s.Pages[pageID] = pageState{
+		LastEditedTime: lastEditedTime,
+		Path:           path,
+		Title:          title,
+	}
+
+	if previous.Path != path {
+		return previous.Path
+	}
+	return ""
+}
+
+func (s *syncState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0770); err != nil {
+		return fmt.Errorf("failed to create the directory for the sync state. error: %w", err)
+	}
+
+	if err = os.WriteFile(s.path, content, 0660); err != nil {
+		return fmt.Errorf("failed to write sync state %s. error: %w", s.path, err)
+	}
+
+	return nil
+}
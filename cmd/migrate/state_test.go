@@ -0,0 +1,248 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func TestSyncState_Unchanged(t *testing.T) {
+	vault := t.TempDir()
+	edited := time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC)
+
+	written := filepath.Join(vault, "Written.md")
+	if err := os.WriteFile(written, []byte("written"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := loadSyncState(vault)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	state.setPage("written", edited, written, "Written")
+	state.setPage("deleted", edited, filepath.Join(vault, "Deleted.md"), "Deleted")
+
+	tests := []struct {
+		name       string
+		pageID     string
+		lastEdited time.Time
+		path       string
+		expected   bool
+	}{
+		{"unchanged", "written", edited, written, true},
+		{"same instant in another zone", "written", edited.In(time.FixedZone("CEST", 2*60*60)), written, true},
+		{"edited since", "written", edited.Add(time.Minute), written, false},
+		{"moved", "written", edited, filepath.Join(vault, "Moved.md"), false},
+		{"file deleted from the vault", "deleted", edited, filepath.Join(vault, "Deleted.md"), false},
+		{"never migrated", "new", edited, filepath.Join(vault, "New.md"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if unchanged := state.unchanged(test.pageID, test.lastEdited, test.path); unchanged != test.expected {
+				t.Errorf("incorrect unchanged expected %t got: %t", test.expected, unchanged)
+			}
+		})
+	}
+}
+
+func TestSyncState_SetPage(t *testing.T) {
+	state, err := loadSyncState(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	edited := time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"first migration", "Notes/Page.md", ""},
+		{"same path", "Notes/Page.md", ""},
+		{"moved", "Archive/Page.md", "Notes/Page.md"},
+	}
+
+	for _, test := range tests {
+		if previous := state.setPage("page", edited, test.path, "Page"); previous != test.expected {
+			t.Errorf("%s: incorrect previous path expected %q got: %q", test.name, test.expected, previous)
+		}
+	}
+
+	expected := pageState{LastEditedTime: edited, Path: "Archive/Page.md", Title: "Page"}
+	if page := state.Pages["page"]; page != expected {
+		t.Errorf("incorrect page state expected %+v got: %+v", expected, page)
+	}
+}
+
+func TestSyncState_LastSync(t *testing.T) {
+	state, err := loadSyncState(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	if _, ok := state.lastSync("db"); ok {
+		t.Errorf("incorrect last sync expected none for a database never migrated")
+	}
+
+	synced := time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC)
+	state.setLastSync("db", synced)
+
+	last, ok := state.lastSync("db")
+	if !ok || !last.Equal(synced) {
+		t.Errorf("incorrect last sync expected %s got: %s", synced, last)
+	}
+
+	if _, ok := state.lastSync("other"); ok {
+		t.Errorf("incorrect last sync expected none for another database")
+	}
+}
+
+func TestSyncState_SaveAndLoad(t *testing.T) {
+	vault := filepath.Join(t.TempDir(), "vault")
+
+	state, err := loadSyncState(vault)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if len(state.Databases) != 0 || len(state.Pages) != 0 {
+		t.Fatalf("incorrect state expected empty without a state file got: %+v", state)
+	}
+
+	synced := time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC)
+	edited := time.Date(2023, 4, 4, 8, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	state.setLastSync("db", synced)
+	state.setPage("page", edited, filepath.Join(vault, "Page.md"), "Page")
+
+	// The vault is created when missing
+	if err = state.save(); err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	loaded, err := loadSyncState(vault)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+
+	if last, ok := loaded.lastSync("db"); !ok || !last.Equal(synced) {
+		t.Errorf("incorrect last sync expected %s got: %s", synced, last)
+	}
+
+	page, ok := loaded.Pages["page"]
+	if !ok {
+		t.Fatalf("incorrect pages expected page to be loaded got: %+v", loaded.Pages)
+	}
+	if !page.LastEditedTime.Equal(edited) || page.Path != filepath.Join(vault, "Page.md") || page.Title != "Page" {
+		t.Errorf("incorrect page state got: %+v", page)
+	}
+
+	if err = os.WriteFile(filepath.Join(vault, stateFileName), []byte("{"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadSyncState(vault); err == nil {
+		t.Errorf("expected an error loading a corrupted state file got: nil")
+	}
+}
+
+func TestFetchChangedDBPages_SecondRun(t *testing.T) {
+	vault, paths, id, selected, full := *obsidianVault, pagePaths, *databaseID, *format, *fullSync
+	defer func() { *obsidianVault, pagePaths, *databaseID, *format, *fullSync = vault, paths, id, selected, full }()
+
+	*obsidianVault = t.TempDir()
+	*databaseID = "journal"
+	*format = formatObsidian
+	*fullSync = false
+
+	edited := time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC)
+	entry := func(id, title string) notion.Page {
+		return notion.Page{
+			ID:             id,
+			Parent:         notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: "journal"},
+			LastEditedTime: edited,
+			Properties: notion.DatabasePageProperties{
+				"Name": {Type: notion.DBPropTypeTitle, Title: []notion.RichText{{PlainText: title}}},
+			},
+		}
+	}
+	unchanged, updated := entry("unchanged", "Unchanged"), entry("updated", "Updated")
+
+	fake := &client.Fake{
+		DatabasePages: map[string][]notion.Page{"journal": {unchanged, updated}},
+		Blocks: map[string][]notion.Block{
+			"unchanged": blocksFromJSON(t, "["+blockJSON("a", "paragraph", "first", false)+"]"),
+			"updated":   blocksFromJSON(t, "["+blockJSON("b", "paragraph", "second", false)+"]"),
+		},
+	}
+
+	synced := time.Date(2023, 4, 6, 8, 0, 0, 0, time.UTC)
+
+	run := func() []job {
+		state, err := loadSyncState(*obsidianVault)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pagePaths, err = newNotePaths(*obsidianVault, collisionSuffix, state); err != nil {
+			t.Fatal(err)
+		}
+
+		pages, err := fetchChangedDBPages(fake, state)
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+
+		notePaths := map[string]string{}
+		for _, page := range pages {
+			if notePaths[page.ID], err = pagePaths.assign(page.ID, filepath.Join(*obsidianVault, pageTitle(page)+".md")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		journal, err := openJournal(*obsidianVault, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer journal.close()
+
+		jobs, err := migrationJobs(fake, pages, notePaths, map[string]bool{}, map[string]bool{}, state, journal)
+		if err != nil {
+			t.Fatalf("expected nil got: %v", err)
+		}
+
+		queue := newQueue("testing")
+		queue.addJobs(jobs)
+		if errorJobs := runWorkers(queue, journal, 2); len(errorJobs) != 0 {
+			t.Fatalf("incorrect failed jobs expected none got: %v", errorJobs)
+		}
+
+		state.setLastSync(*databaseID, synced)
+		if err = state.save(); err != nil {
+			t.Fatal(err)
+		}
+		return jobs
+	}
+
+	if jobs := run(); len(jobs) != 2 {
+		t.Fatalf("incorrect jobs expected both pages on the first run got: %d", len(jobs))
+	}
+	if fake.LastQuery == nil || fake.LastQuery.Filter != nil {
+		t.Errorf("incorrect query expected no filter on the first run got: %+v", fake.LastQuery)
+	}
+
+	// The fake returns every page, the unchanged one is skipped by the sync
+	// state
+	fake.DatabasePages["journal"][1].LastEditedTime = synced.Add(time.Minute)
+	jobs := run()
+
+	filter := fake.LastQuery.Filter
+	if filter == nil || filter.Timestamp != notion.TimestampLastEditedTime || filter.LastEditedTime == nil || filter.LastEditedTime.OnOrAfter == nil || !filter.LastEditedTime.OnOrAfter.Equal(synced) {
+		t.Errorf("incorrect filter expected last_edited_time on or after %s got: %+v", synced, filter)
+	}
+	if len(jobs) != 1 || jobs[0].id != "updated" {
+		t.Errorf("incorrect jobs expected [updated] got: %v", jobs)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+// writeTable writes the table as a GitHub flavored markdown table, every
+// line starting with prefix so it stays within its parent block.
+func writeTable(client client.NotionClient, block *notion.TableBlock, children []*blockNode, buffer *bufio.Writer, notePath, prefix string) error {
+	rows := [][]string{}
+	for _, child := range children {
+		row, ok := child.block.(*notion.TableRowBlock)
+		if !ok {
+			continue
+		}
+
+		cells := make([]string, block.TableWidth)
+		for i, cell := range row.Cells {
+			if i >= block.TableWidth {
+				break
+			}
+			text, err := richTextToString(client, notePath, cell)
+			if err != nil {
+				return err
+			}
+			cells[i] = escapeTableCell(text)
+		}
+		rows = append(rows, cells)
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if block.HasRowHeader {
+		first := 0
+		if block.HasColumnHeader {
+			first = 1
+		}
+		for _, row := range rows[first:] {
+			if len(row) > 0 && row[0] != "" {
+				row[0] = "**" + row[0] + "**"
+			}
+		}
+	}
+
+	// Markdown tables always have a header. Without one in Notion, it is
+	// left empty so no row is displayed as one.
+	header := make([]string, block.TableWidth)
+	if block.HasColumnHeader {
+		header = rows[0]
+		rows = rows[1:]
+	}
+
+	widths := make([]int, block.TableWidth)
+	for i := range widths {
+		widths[i] = 3
+	}
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if width := utf8.RuneCountInString(cell); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	separator := make([]string, block.TableWidth)
+	for i, width := range widths {
+		separator[i] = strings.Repeat("-", width)
+	}
+
+	writeTableRow(buffer, prefix, header, widths)
+	writeTableRow(buffer, prefix, separator, widths)
+	for _, row := range rows {
+		writeTableRow(buffer, prefix, row, widths)
+	}
+
+	return nil
+}
+
+func writeTableRow(buffer *bufio.Writer, prefix string, cells []string, widths []int) {
+	buffer.WriteString(prefix)
+	buffer.WriteString("|")
+	for i, cell := range cells {
+		buffer.WriteString(" ")
+		buffer.WriteString(cell)
+		buffer.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+		buffer.WriteString(" |")
+	}
+	buffer.WriteString("\n")
+}
+
+// escapeTableCell keeps the content of a cell within its column. Pipes would
+// start a new column and line breaks a new row.
+func escapeTableCell(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	text = strings.ReplaceAll(text, "\r\n", "<br>")
+	text = strings.ReplaceAll(text, "\n", "<br>")
+	return strings.TrimSpace(text)
+}
@@ -1,20 +1,25 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"time"
 
+	"github.com/GustavoCaso/notion_workflows/pkg/auth"
 	"github.com/GustavoCaso/notion_workflows/pkg/client"
-	"github.com/GustavoCaso/notion_workflows/pkg/types"
+	"github.com/GustavoCaso/notion_workflows/pkg/config"
 	"github.com/GustavoCaso/notion_workflows/pkg/utils"
+	"github.com/dstotijn/go-notion"
 )
 
-const (
+// Default IDs used when the selected profile does not override them.
+var (
 	habitTrackerDatabaseID  = "9e031d67-5c5f-4183-9e1c-7e2e9330cae3"
 	MonthTrackingDatabaseID = "83ab95f9-d1d9-489e-b761-8dfbe839ba37"
 	WeekTrackingDatabaseID  = "8a9a5eb6-8d2c-49a5-a286-ececece9b2b5"
+
+	habitTrackerConfigurationPageID = "191aa568-5475-454c-af59-408be8f7c435"
 )
 
 type trackingPageInfo struct {
@@ -60,18 +65,14 @@ const DATE_FORMAT = "2006-01-02"
 
 var month int
 var year int
-var filterQuery = string(`{
-	"filter": {
-			"property": "Name",
-			"text": {
-					"equals": "%s"
-			}
-	}
-}`)
+var tokenFlags *auth.Flags
+var profileFlags *config.Flags
 
 func init() {
 	flag.IntVar(&month, "month", 0, "Month to create tracking pages")
 	flag.IntVar(&year, "year", 0, "Year to create month pages")
+	tokenFlags = auth.RegisterFlags(flag.CommandLine)
+	profileFlags = config.RegisterFlags(flag.CommandLine)
 }
 
 func main() {
@@ -191,12 +192,41 @@ func main() {
 		}
 	}
 
-	client := client.NewHTTPClient(utils.GetAuthenticationToken())
+	profile, err := profileFlags.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	if profile != nil {
+		applyProfile(profile.Monthly)
+	}
+
+	token, err := config.TokenSource(profile, tokenFlags, "MORNING_WORKFLOW_API_TOKEN", "NOTION_TOKEN").Token()
+	if err != nil {
+		panic(fmt.Errorf("failed to find the notion token. error: %w", err))
+	}
+
+	client := client.NewClient(token)
 	generateMonthsPages(client, month)
 
 	fmt.Println("Success")
 }
 
+func applyProfile(monthly config.MonthlyConfig) {
+	if monthly.HabitTrackerDatabaseID != "" {
+		habitTrackerDatabaseID = monthly.HabitTrackerDatabaseID
+	}
+	if monthly.MonthTrackingDatabaseID != "" {
+		MonthTrackingDatabaseID = monthly.MonthTrackingDatabaseID
+	}
+	if monthly.WeekTrackingDatabaseID != "" {
+		WeekTrackingDatabaseID = monthly.WeekTrackingDatabaseID
+	}
+	if monthly.HabitTrackerConfigurationPageID != "" {
+		habitTrackerConfigurationPageID = monthly.HabitTrackerConfigurationPageID
+	}
+}
+
 func generateMonthsPages(client client.NotionClient, monthData monthData) {
 	weekPageIDs := weekPageIDs{}
 
@@ -215,7 +245,10 @@ func generateMonthsPages(client client.NotionClient, monthData monthData) {
 			HabitTrackingPageIDs: pagesIds.habitTrakerPageIDs,
 		}
 
-		weekPageId := createWeekPage(client, weekPageInfo)
+		weekPageId, err := createWeekPage(client, weekPageInfo)
+		if err != nil {
+			panic(err)
+		}
 		weekPageIDs = append(weekPageIDs, weekPageId)
 	}
 
@@ -226,7 +259,9 @@ func generateMonthsPages(client client.NotionClient, monthData monthData) {
 		WeekPageIDs: weekPageIDs,
 	}
 
-	createMonthPage(client, monthPageInfo)
+	if _, err := createMonthPage(client, monthPageInfo); err != nil {
+		panic(err)
+	}
 }
 
 func generateDayPages(client client.NotionClient, currentDay time.Time, pageIds *trackingPagesIDs) {
@@ -245,83 +280,195 @@ func generateDayPages(client client.NotionClient, currentDay time.Time, pageIds
 	pageIds.habitTrakerPageIDs = append(pageIds.habitTrakerPageIDs, habitTrackerPageID)
 }
 
-func createWeekPage(client client.NotionClient, pageInfo weekPageInfo) string {
-	filter := fmt.Sprintf(filterQuery, pageInfo.Title)
-	findResponse := client.FindPages(WeekTrackingDatabaseID, bytes.NewBuffer([]byte(filter)))
+func createWeekPage(c client.NotionClient, pageInfo weekPageInfo) (string, error) {
+	findResponse, err := client.FindPages(context.Background(), c, WeekTrackingDatabaseID, titleFilter(pageInfo.Title))
+	if err != nil {
+		return "", err
+	}
 	pageFound := len(findResponse) == 1
 
 	if pageFound {
-		habitTrackerRelation := findResponse[0].Properties["Habit Tracker (Relation)"]["relation"].([]interface{})
-		for _, IDmap := range habitTrackerRelation {
-			IDmapCasted := IDmap.(map[string]interface{})
-			id := IDmapCasted["id"].(string)
-			if !utils.Contains(id, pageInfo.HabitTrackingPageIDs) {
-				pageInfo.HabitTrackingPageIDs = append(pageInfo.HabitTrackingPageIDs, id)
+		props, ok := findResponse[0].Properties.(notion.DatabasePageProperties)
+		if !ok {
+			return "", fmt.Errorf("week page %s is not a database page", findResponse[0].ID)
+		}
+		for _, relation := range props["Habit Tracker (Relation)"].Relation {
+			if !utils.Contains(relation.ID, pageInfo.HabitTrackingPageIDs) {
+				pageInfo.HabitTrackingPageIDs = append(pageInfo.HabitTrackingPageIDs, relation.ID)
 			}
 		}
 	}
 
-	buf, err := utils.ExecuteTemplate("templates/week_page.json.txt", "createWeekPage", pageInfo)
-	if err != nil {
-		panic(err)
+	properties := notion.DatabasePageProperties{
+		"Habit Tracker Configuration (Relation)": notion.DatabasePageProperty{
+			Relation: []notion.Relation{{ID: habitTrackerConfigurationPageID}},
+		},
+		"Habit Tracker (Relation)": notion.DatabasePageProperty{
+			Relation: relations(pageInfo.HabitTrackingPageIDs),
+		},
+		"Dates": notion.DatabasePageProperty{
+			Date: dateRange(pageInfo.StartDate, pageInfo.EndDate),
+		},
+		"Name": notion.DatabasePageProperty{
+			Title: title(pageInfo.Title),
+		},
 	}
 
-	var response types.PageResponse
+	var response notion.Page
 	if pageFound {
-		response = client.UpdatePage(findResponse[0].ID, bytes.NewBuffer(buf.Bytes()))
+		response, err = c.UpdatePage(context.Background(), findResponse[0].ID, notion.UpdatePageParams{
+			DatabasePageProperties: properties,
+		})
+		if err != nil {
+			return "", err
+		}
 		fmt.Printf("Success updating week page for %+v\n", pageInfo)
 	} else {
-		response = client.CreatePage(bytes.NewBuffer(buf.Bytes()))
+		response, err = c.CreatePage(context.Background(), notion.CreatePageParams{
+			ParentType:             notion.ParentTypeDatabase,
+			ParentID:               WeekTrackingDatabaseID,
+			DatabasePageProperties: &properties,
+		})
+		if err != nil {
+			return "", err
+		}
 		fmt.Printf("Success creating week page for %+v\n", pageInfo)
 	}
 
-	return response.ID
+	return response.ID, nil
 }
 
-func createMonthPage(client client.NotionClient, pageInfo monthPageInfo) string {
-	filter := fmt.Sprintf(filterQuery, pageInfo.Title)
-	findResponse := client.FindPages(MonthTrackingDatabaseID, bytes.NewBuffer([]byte(filter)))
+func createMonthPage(c client.NotionClient, pageInfo monthPageInfo) (string, error) {
+	findResponse, err := client.FindPages(context.Background(), c, MonthTrackingDatabaseID, titleFilter(pageInfo.Title))
+	if err != nil {
+		return "", err
+	}
 	pageFound := len(findResponse) == 1
 
 	if pageFound {
-		weekPagesRelation := findResponse[0].Properties["Weeks"]["relation"].([]interface{})
-		for _, IDmap := range weekPagesRelation {
-			IDmapCasted := IDmap.(map[string]interface{})
-			id := IDmapCasted["id"].(string)
-			if !utils.Contains(id, pageInfo.WeekPageIDs) {
-				pageInfo.WeekPageIDs = append(pageInfo.WeekPageIDs, id)
+		props, ok := findResponse[0].Properties.(notion.DatabasePageProperties)
+		if !ok {
+			return "", fmt.Errorf("month page %s is not a database page", findResponse[0].ID)
+		}
+		for _, relation := range props["Weeks"].Relation {
+			if !utils.Contains(relation.ID, pageInfo.WeekPageIDs) {
+				pageInfo.WeekPageIDs = append(pageInfo.WeekPageIDs, relation.ID)
 			}
 		}
 	}
 
-	buf, err := utils.ExecuteTemplate("templates/month_page.json.txt", "createMonthPage", pageInfo)
-	if err != nil {
-		panic(err)
+	properties := notion.DatabasePageProperties{
+		"Weeks": notion.DatabasePageProperty{
+			Relation: relations(pageInfo.WeekPageIDs),
+		},
+		"Dates": notion.DatabasePageProperty{
+			Date: dateRange(pageInfo.StartDate, pageInfo.EndDate),
+		},
+		"Name": notion.DatabasePageProperty{
+			Title: title(pageInfo.Title),
+		},
 	}
 
-	var response types.PageResponse
+	var response notion.Page
 	if pageFound {
-		response = client.UpdatePage(findResponse[0].ID, bytes.NewBuffer(buf.Bytes()))
+		response, err = c.UpdatePage(context.Background(), findResponse[0].ID, notion.UpdatePageParams{
+			DatabasePageProperties: properties,
+		})
+		if err != nil {
+			return "", err
+		}
 
 		fmt.Printf("Success updating month page for %+v\n", pageInfo)
 
 	} else {
-		response = client.CreatePage(bytes.NewBuffer(buf.Bytes()))
+		response, err = c.CreatePage(context.Background(), notion.CreatePageParams{
+			ParentType:             notion.ParentTypeDatabase,
+			ParentID:               MonthTrackingDatabaseID,
+			DatabasePageProperties: &properties,
+		})
+		if err != nil {
+			return "", err
+		}
 
 		fmt.Printf("Success creating month page for %+v\n", pageInfo)
 	}
 
+	return response.ID, nil
+}
+
+func createTrackingPage(c client.NotionClient, pageInfo trackingPageInfo) string {
+	properties := notion.DatabasePageProperties{
+		"Date": notion.DatabasePageProperty{
+			Date: dateRange(pageInfo.Date, ""),
+		},
+		"Name": notion.DatabasePageProperty{
+			Title: title(pageInfo.Title),
+		},
+	}
+
+	response, err := client.FindOrCreatePage(context.Background(), c, pageInfo.DatabaseID, titleFilter(pageInfo.Title), notion.CreatePageParams{
+		ParentType:             notion.ParentTypeDatabase,
+		ParentID:               pageInfo.DatabaseID,
+		DatabasePageProperties: &properties,
+		Icon: &notion.Icon{
+			Type:  notion.IconTypeEmoji,
+			Emoji: &pageInfo.Emoji,
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
 	return response.ID
 }
 
-func createTrackingPage(client client.NotionClient, pageInfo trackingPageInfo) string {
-	buf, err := utils.ExecuteTemplate("templates/tracking_page.json", "createTrackingPage", pageInfo)
+func titleFilter(title string) *notion.DatabaseQueryFilter {
+	return &notion.DatabaseQueryFilter{
+		Property: "Name",
+		DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+			Title: &notion.TextPropertyFilter{
+				Equals: title,
+			},
+		},
+	}
+}
+
+func title(content string) []notion.RichText {
+	return []notion.RichText{
+		{
+			Type: notion.RichTextTypeText,
+			Text: &notion.Text{
+				Content: content,
+			},
+		},
+	}
+}
+
+func relations(ids []string) []notion.Relation {
+	result := []notion.Relation{}
+	for _, id := range ids {
+		result = append(result, notion.Relation{ID: id})
+	}
+	return result
+}
+
+func dateRange(startDate, endDate string) *notion.Date {
+	start, err := notion.ParseDateTime(startDate)
 	if err != nil {
 		panic(err)
 	}
 
-	filter := fmt.Sprintf(filterQuery, pageInfo.Title)
-	response := client.FindOrCreatePage(pageInfo.DatabaseID, bytes.NewBuffer([]byte(filter)), bytes.NewBuffer(buf.Bytes()))
+	date := &notion.Date{
+		Start: start,
+	}
 
-	return response.ID
+	if endDate != "" {
+		end, err := notion.ParseDateTime(endDate)
+		if err != nil {
+			panic(err)
+		}
+		date.End = &end
+	}
+
+	return date
 }
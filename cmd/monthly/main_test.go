@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/client"
+	"github.com/dstotijn/go-notion"
+)
+
+func relationIDs(relations []notion.Relation) string {
+	ids := []string{}
+	for _, relation := range relations {
+		ids = append(ids, relation.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestCreateWeekPage(t *testing.T) {
+	existing := notion.Page{
+		ID:     "week-14",
+		Parent: notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: WeekTrackingDatabaseID},
+		Properties: notion.DatabasePageProperties{
+			"Habit Tracker (Relation)": {Relation: []notion.Relation{{ID: "day-1"}, {ID: "day-0"}}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		pages     []notion.Page
+		relations string
+	}{
+		{"create", nil, "day-1,day-2"},
+		{"update keeps the existing relations", []notion.Page{existing}, "day-1,day-2,day-0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &client.Fake{
+				DatabasePages: map[string][]notion.Page{WeekTrackingDatabaseID: test.pages},
+				Pages:         map[string]notion.Page{},
+			}
+			for _, page := range test.pages {
+				fake.Pages[page.ID] = page
+			}
+
+			id, err := createWeekPage(fake, weekPageInfo{
+				StartDate:            "2023-04-03",
+				EndDate:              "2023-04-09",
+				Title:                "Week 14 (2023)",
+				HabitTrackingPageIDs: []string{"day-1", "day-2"},
+			})
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+
+			page, ok := fake.Pages[id]
+			if !ok {
+				t.Fatalf("incorrect page expected %s to exist", id)
+			}
+			if page.Parent.Type != notion.ParentTypeDatabase {
+				t.Errorf("incorrect parent expected %s got: %s", notion.ParentTypeDatabase, page.Parent.Type)
+			}
+
+			props, ok := page.Properties.(notion.DatabasePageProperties)
+			if !ok {
+				t.Fatalf("incorrect properties expected database page properties got: %T", page.Properties)
+			}
+
+			if result := relationIDs(props["Habit Tracker (Relation)"].Relation); result != test.relations {
+				t.Errorf("incorrect habit tracker relations expected %s got: %s", test.relations, result)
+			}
+			if result := relationIDs(props["Habit Tracker Configuration (Relation)"].Relation); result != habitTrackerConfigurationPageID {
+				t.Errorf("incorrect configuration relation expected %s got: %s", habitTrackerConfigurationPageID, result)
+			}
+
+			dates := props["Dates"].Date
+			if dates == nil || dates.End == nil {
+				t.Fatalf("incorrect dates expected a range got: %+v", dates)
+			}
+			if start, end := dates.Start.Format(DATE_FORMAT), dates.End.Format(DATE_FORMAT); start != "2023-04-03" || end != "2023-04-09" {
+				t.Errorf("incorrect dates expected 2023-04-03 2023-04-09 got: %s %s", start, end)
+			}
+
+			if name := props["Name"].Title; len(name) != 1 || name[0].Text.Content != "Week 14 (2023)" {
+				t.Errorf("incorrect name expected Week 14 (2023) got: %+v", name)
+			}
+		})
+	}
+}
+
+func TestCreateMonthPage(t *testing.T) {
+	info := monthPageInfo{
+		Title:       "April 2023",
+		StartDate:   "2023-04-01",
+		EndDate:     "2023-04-30",
+		WeekPageIDs: []string{"week-13", "week-14"},
+	}
+
+	existing := notion.Page{
+		ID:     "april",
+		Parent: notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: MonthTrackingDatabaseID},
+		Properties: notion.DatabasePageProperties{
+			"Weeks": {Relation: []notion.Relation{{ID: "week-17"}}},
+		},
+	}
+
+	fake := &client.Fake{
+		DatabasePages: map[string][]notion.Page{MonthTrackingDatabaseID: {existing}},
+		Pages:         map[string]notion.Page{existing.ID: existing},
+	}
+
+	id, err := createMonthPage(fake, info)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if id != "april" {
+		t.Errorf("incorrect page expected april to be updated got: %s", id)
+	}
+
+	props := fake.Pages[id].Properties.(notion.DatabasePageProperties)
+	if result := relationIDs(props["Weeks"].Relation); result != "week-13,week-14,week-17" {
+		t.Errorf("incorrect weeks expected week-13,week-14,week-17 got: %s", result)
+	}
+	if name := props["Name"].Title; len(name) != 1 || name[0].Text.Content != "April 2023" {
+		t.Errorf("incorrect name expected April 2023 got: %+v", name)
+	}
+}
+
+func TestCreatePages_NotDatabasePage(t *testing.T) {
+	page := notion.Page{
+		ID:         "not-a-row",
+		Properties: notion.PageProperties{Title: notion.PageTitle{Title: title("Week 14 (2023)")}},
+	}
+
+	fake := &client.Fake{
+		DatabasePages: map[string][]notion.Page{
+			WeekTrackingDatabaseID:  {page},
+			MonthTrackingDatabaseID: {page},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		create func() error
+	}{
+		{"week", func() error {
+			_, err := createWeekPage(fake, weekPageInfo{StartDate: "2023-04-03", EndDate: "2023-04-09", Title: "Week 14 (2023)"})
+			return err
+		}},
+		{"month", func() error {
+			_, err := createMonthPage(fake, monthPageInfo{StartDate: "2023-04-01", EndDate: "2023-04-30", Title: "April 2023"})
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.create()
+			if err == nil || !strings.Contains(err.Error(), "not-a-row is not a database page") {
+				t.Errorf("incorrect error expected not a database page got: %v", err)
+			}
+		})
+	}
+}
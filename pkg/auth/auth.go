@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNoToken is returned by a TokenSource that has no token to offer, so a
+// Chain can move on to the next source.
+var ErrNoToken = errors.New("no notion token found")
+
+// TokenSource provides the token used to authenticate against the Notion API.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// Static is a token provided directly, usually through a command line flag.
+type Static string
+
+func (s Static) Token() (string, error) {
+	if s == "" {
+		return "", ErrNoToken
+	}
+	return string(s), nil
+}
+
+// Env reads the token from the first non empty environment variable.
+type Env []string
+
+func (e Env) Token() (string, error) {
+	for _, name := range e {
+		if value := os.Getenv(name); value != "" {
+			return value, nil
+		}
+	}
+	return "", ErrNoToken
+}
+
+// File reads the token from a file containing only the token.
+type File string
+
+func (f File) Token() (string, error) {
+	if f == "" {
+		return "", ErrNoToken
+	}
+
+	content, err := os.ReadFile(string(f))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNoToken
+		}
+		return "", fmt.Errorf("failed to read token file %s. error: %w", f, err)
+	}
+
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
+
+// Chain tries each source in order and returns the first token found.
+type Chain []TokenSource
+
+func (c Chain) Token() (string, error) {
+	for _, source := range c {
+		token, err := source.Token()
+		if errors.Is(err, ErrNoToken) {
+			continue
+		}
+		return token, err
+	}
+	return "", ErrNoToken
+}
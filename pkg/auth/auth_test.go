@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChain_FirstTokenWins(t *testing.T) {
+	t.Setenv("AUTH_TEST_TOKEN", "from-env")
+
+	tests := []struct {
+		name     string
+		chain    Chain
+		expected string
+	}{
+		{"flag before env", Chain{Static("from-flag"), Env{"AUTH_TEST_TOKEN"}}, "from-flag"},
+		{"env when flag is empty", Chain{Static(""), Env{"AUTH_TEST_TOKEN"}}, "from-env"},
+		{"missing file is skipped", Chain{File("does-not-exist"), Env{"AUTH_TEST_TOKEN"}}, "from-env"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := test.chain.Token()
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if token != test.expected {
+				t.Errorf("incorrect token expected '%s' got: %s", test.expected, token)
+			}
+		})
+	}
+
+	if _, err := (Chain{Static(""), Env{"AUTH_TEST_MISSING"}}).Token(); !errors.Is(err, ErrNoToken) {
+		t.Errorf("expected ErrNoToken got: %v", err)
+	}
+}
+
+func TestNetrc_Workspaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	content := `# notion workspaces
+machine github.com login me password not-notion
+machine api.notion.com login personal password secret_personal
+machine api.notion.com
+	login team
+	password secret_team
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		workspace string
+		expected  string
+	}{
+		{"", "secret_personal"},
+		{"personal", "secret_personal"},
+		{"team", "secret_team"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.workspace, func(t *testing.T) {
+			token, err := Netrc{Path: path, Workspace: test.workspace}.Token()
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if token != test.expected {
+				t.Errorf("incorrect token expected '%s' got: %s", test.expected, token)
+			}
+		})
+	}
+
+	if _, err := (Netrc{Path: path, Workspace: "unknown"}).Token(); !errors.Is(err, ErrNoToken) {
+		t.Errorf("expected ErrNoToken got: %v", err)
+	}
+}
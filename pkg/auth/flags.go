@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+// DefaultRedirectAddr is the address of the local OAuth redirect listener.
+const DefaultRedirectAddr = "localhost:8765"
+
+// Flags holds the command line options shared by the commands to locate the
+// Notion token.
+type Flags struct {
+	Token             string
+	TokenFile         string
+	Credentials       string
+	Workspace         string
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthRedirectAddr string
+	OAuthCache        string
+}
+
+// RegisterFlags defines the token flags on fs.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+
+	fs.StringVar(&f.Token, "token", "", "notion token")
+	fs.StringVar(&f.TokenFile, "token-file", os.Getenv("NOTION_TOKEN_FILE"), "file containing the notion token")
+	fs.StringVar(&f.Credentials, "credentials", os.Getenv("NOTION_CREDENTIALS"), "netrc-style credentials file. Defaults to ~/.netrc")
+	fs.StringVar(&f.Workspace, "workspace", os.Getenv("NOTION_WORKSPACE"), "workspace login to select from the credentials file")
+	fs.StringVar(&f.OAuthClientID, "oauth-client-id", os.Getenv("NOTION_OAUTH_CLIENT_ID"), "OAuth client ID of a notion public integration")
+	fs.StringVar(&f.OAuthClientSecret, "oauth-client-secret", os.Getenv("NOTION_OAUTH_CLIENT_SECRET"), "OAuth client secret of a notion public integration")
+	fs.StringVar(&f.OAuthRedirectAddr, "oauth-redirect", DefaultRedirectAddr, "address of the local OAuth redirect listener")
+	fs.StringVar(&f.OAuthCache, "oauth-cache", defaultOAuthCache(), "file in which to store the OAuth token")
+
+	return f
+}
+
+// Source returns the chain of token sources described by the flags: the
+// token flag, the environment variables, the token file, the credentials file
+// and finally the OAuth flow.
+func (f *Flags) Source(envVars ...string) TokenSource {
+	return Chain{
+		Static(f.Token),
+		Env(envVars),
+		File(f.TokenFile),
+		Netrc{
+			Path:      f.Credentials,
+			Workspace: f.Workspace,
+		},
+		OAuth{
+			ClientID:     f.OAuthClientID,
+			ClientSecret: f.OAuthClientSecret,
+			RedirectAddr: f.OAuthRedirectAddr,
+			CachePath:    f.OAuthCache,
+		},
+	}
+}
+
+func defaultOAuthCache() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "notion_workflows", "oauth_token.json")
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NetrcMachine is the machine name looked up in the credentials file.
+const NetrcMachine = "api.notion.com"
+
+// Netrc reads the token from a .netrc-style credentials file. Each workspace
+// is an entry for the Notion API machine, with the workspace as login and the
+// token as password:
+//
+//	machine api.notion.com login personal password secret_xxx
+//	machine api.notion.com login team password secret_yyy
+//
+// When Workspace is empty the first Notion entry, or the default entry, is used.
+type Netrc struct {
+	Path      string
+	Workspace string
+}
+
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+func (n Netrc) Token() (string, error) {
+	path := n.Path
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ErrNoToken
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNoToken
+		}
+		return "", fmt.Errorf("failed to open credentials file %s. error: %w", path, err)
+	}
+	defer f.Close()
+
+	entries, err := parseNetrc(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse credentials file %s. error: %w", path, err)
+	}
+
+	for _, entry := range entries {
+		if entry.machine != NetrcMachine && entry.machine != "" {
+			continue
+		}
+		if n.Workspace != "" && entry.login != n.Workspace {
+			continue
+		}
+		if entry.password != "" {
+			return entry.password, nil
+		}
+	}
+
+	return "", ErrNoToken
+}
+
+func parseNetrc(f *os.File) ([]netrcEntry, error) {
+	entries := []netrcEntry{}
+	var current *netrcEntry
+
+	scanner := bufio.NewScanner(f)
+	inMacro := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Macro definitions run until the next empty line.
+		if inMacro {
+			if strings.TrimSpace(line) == "" {
+				inMacro = false
+			}
+			continue
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine":
+				if i+1 >= len(fields) {
+					return nil, errors.New("machine without a name")
+				}
+				i++
+				entries = append(entries, netrcEntry{machine: fields[i]})
+				current = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{})
+				current = &entries[len(entries)-1]
+			case "login", "password", "account":
+				if current == nil {
+					return nil, fmt.Errorf("%s outside of a machine entry", fields[i])
+				}
+				if i+1 >= len(fields) {
+					return nil, fmt.Errorf("%s without a value", fields[i])
+				}
+				i++
+				if fields[i-1] == "login" {
+					current.login = fields[i]
+				} else if fields[i-1] == "password" {
+					current.password = fields[i]
+				}
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			default:
+				return nil, fmt.Errorf("unexpected token %q", fields[i])
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The Notion OAuth endpoints, variables so tests can point them to a local
+// server.
+var (
+	oauthAuthorizeURL = "https://api.notion.com/v1/oauth/authorize"
+	oauthTokenURL     = "https://api.notion.com/v1/oauth/token"
+)
+
+// oauthShutdownTimeout bounds how long the redirect listener waits for the
+// callback response to be sent before closing.
+const oauthShutdownTimeout = 5 * time.Second
+
+// OAuth obtains a token through the OAuth flow of a Notion public integration.
+//
+// The first time it runs it starts a local listener on RedirectAddr, asks the
+// user to open the authorization URL and exchanges the returned code for a
+// token. The token is stored in CachePath and reused, and refreshed when it
+// expires, on later runs.
+type OAuth struct {
+	ClientID     string
+	ClientSecret string
+	// RedirectAddr is the host:port of the local redirect listener. The
+	// integration must have http://<RedirectAddr>/callback as redirect URI.
+	RedirectAddr string
+	CachePath    string
+	// Prompt shows the authorization URL to the user. It defaults to
+	// printing it on stderr.
+	Prompt func(authorizeURL string)
+}
+
+// oauthToken is the response of the Notion token endpoint, plus the moment
+// it expires, so it can be cached on disk.
+type oauthToken struct {
+	AccessToken   string    `json:"access_token"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	ExpiresIn     int       `json:"expires_in,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+	WorkspaceID   string    `json:"workspace_id,omitempty"`
+	WorkspaceName string    `json:"workspace_name,omitempty"`
+	BotID         string    `json:"bot_id,omitempty"`
+}
+
+func (t oauthToken) expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt.Add(-time.Minute))
+}
+
+func (o OAuth) Token() (string, error) {
+	if o.ClientID == "" || o.ClientSecret == "" {
+		return "", ErrNoToken
+	}
+
+	cached, err := o.readCache()
+	if err != nil {
+		return "", err
+	}
+
+	if cached != nil {
+		if !cached.expired() {
+			return cached.AccessToken, nil
+		}
+
+		if cached.RefreshToken != "" {
+			token, err := o.exchange(map[string]string{
+				"grant_type":    "refresh_token",
+				"refresh_token": cached.RefreshToken,
+			})
+			if err == nil {
+				if token.RefreshToken == "" {
+					token.RefreshToken = cached.RefreshToken
+				}
+				return token.AccessToken, o.writeCache(token)
+			}
+			fmt.Fprintf(os.Stderr, "failed to refresh notion token, starting a new authorization. error: %v\n", err)
+		}
+	}
+
+	token, err := o.authorize()
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, o.writeCache(token)
+}
+
+func (o OAuth) redirectURI() string {
+	return fmt.Sprintf("http://%s/callback", o.RedirectAddr)
+}
+
+func (o OAuth) authorize() (oauthToken, error) {
+	if o.RedirectAddr == "" {
+		return oauthToken{}, errors.New("an OAuth redirect address is required to authorize the integration")
+	}
+
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return oauthToken{}, fmt.Errorf("failed to generate OAuth state. error: %w", err)
+	}
+	state := hex.EncodeToString(stateBytes)
+
+	listener, err := net.Listen("tcp", o.RedirectAddr)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("failed to start OAuth redirect listener on %s. error: %w", o.RedirectAddr, err)
+	}
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	// Only the first callback completes the authorization. Browsers may
+	// reload the page, and later callbacks must not block on the channels.
+	var callback sync.Once
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Get("state") != state:
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			callback.Do(func() { errs <- errors.New("OAuth callback received an invalid state") })
+		case query.Get("error") != "":
+			http.Error(w, "authorization denied", http.StatusBadRequest)
+			callback.Do(func() { errs <- fmt.Errorf("OAuth authorization failed: %s", query.Get("error")) })
+		default:
+			fmt.Fprintln(w, "Authorization complete, you can close this window.")
+			callback.Do(func() { codes <- query.Get("code") })
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), oauthShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	params := url.Values{}
+	params.Set("client_id", o.ClientID)
+	params.Set("response_type", "code")
+	params.Set("owner", "user")
+	params.Set("redirect_uri", o.redirectURI())
+	params.Set("state", state)
+	authorizeURL := oauthAuthorizeURL + "?" + params.Encode()
+
+	if o.Prompt != nil {
+		o.Prompt(authorizeURL)
+	} else {
+		fmt.Fprintf(os.Stderr, "Open the following URL to authorize the integration:\n%s\n", authorizeURL)
+	}
+
+	select {
+	case code := <-codes:
+		return o.exchange(map[string]string{
+			"grant_type":   "authorization_code",
+			"code":         code,
+			"redirect_uri": o.redirectURI(),
+		})
+	case err := <-errs:
+		return oauthToken{}, err
+	case <-time.After(5 * time.Minute):
+		return oauthToken{}, errors.New("timed out waiting for the OAuth authorization")
+	}
+}
+
+func (o OAuth) exchange(body map[string]string) (oauthToken, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, oauthTokenURL, bytes.NewReader(payload))
+	if err != nil {
+		return oauthToken{}, err
+	}
+	request.SetBasicAuth(o.ClientID, o.ClientSecret)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("failed to request OAuth token. error: %w", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return oauthToken{}, fmt.Errorf("failed to request OAuth token. status: %d body: %s", response.StatusCode, responseBody)
+	}
+
+	var token oauthToken
+	if err = json.Unmarshal(responseBody, &token); err != nil {
+		return oauthToken{}, fmt.Errorf("failed to parse OAuth token response. error: %w", err)
+	}
+
+	if token.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+func (o OAuth) readCache() (*oauthToken, error) {
+	if o.CachePath == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(o.CachePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read OAuth token cache %s. error: %w", o.CachePath, err)
+	}
+
+	var token oauthToken
+	if err = json.Unmarshal(content, &token); err != nil {
+		return nil, fmt.Errorf("failed to parse OAuth token cache %s. error: %w", o.CachePath, err)
+	}
+
+	if token.AccessToken == "" {
+		return nil, nil
+	}
+
+	return &token, nil
+}
+
+func (o OAuth) writeCache(token oauthToken) error {
+	if o.CachePath == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.CachePath), 0700); err != nil {
+		return fmt.Errorf("failed to create OAuth token cache directory. error: %w", err)
+	}
+
+	content, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(o.CachePath, content, 0600); err != nil {
+		return fmt.Errorf("failed to write OAuth token cache %s. error: %w", o.CachePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer is a Notion OAuth token endpoint recording the requests it
+// receives.
+type tokenServer struct {
+	response string
+	status   int
+	requests []map[string]string
+	mu       sync.Mutex
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != "client" || clientSecret != "secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, body)
+	s.mu.Unlock()
+
+	if s.status != 0 {
+		http.Error(w, `{"error":"invalid_grant"}`, s.status)
+		return
+	}
+	io.WriteString(w, s.response)
+}
+
+func newTokenServer(t *testing.T, tokens *tokenServer) {
+	server := httptest.NewServer(tokens)
+	previous := oauthTokenURL
+	oauthTokenURL = server.URL
+	t.Cleanup(func() {
+		oauthTokenURL = previous
+		server.Close()
+	})
+}
+
+// freeAddr returns a local address with no listener, for the redirect
+// listener of the OAuth flow.
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func readCachedToken(t *testing.T, path string) oauthToken {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	var token oauthToken
+	if err = json.Unmarshal(content, &token); err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	return token
+}
+
+func TestOAuth_Authorize(t *testing.T) {
+	tokens := &tokenServer{response: `{"access_token":"secret_access","refresh_token":"refresh","expires_in":3600,"workspace_name":"Team"}`}
+	newTokenServer(t, tokens)
+
+	cache := filepath.Join(t.TempDir(), "notion", "token.json")
+	responses := []int{}
+
+	oauth := OAuth{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectAddr: freeAddr(t),
+		CachePath:    cache,
+		Prompt: func(authorizeURL string) {
+			u, err := url.Parse(authorizeURL)
+			if err != nil {
+				t.Errorf("expected nil got: %v", err)
+				return
+			}
+			query := u.Query()
+
+			callback := query.Get("redirect_uri") + "?code=granted&state=" + query.Get("state")
+			// The browser reloads the page, the second callback must not
+			// block the listener
+			for i := 0; i < 2; i++ {
+				response, err := http.Get(callback)
+				if err != nil {
+					t.Errorf("expected nil got: %v", err)
+					return
+				}
+				response.Body.Close()
+				responses = append(responses, response.StatusCode)
+			}
+		},
+	}
+
+	token, err := oauth.Token()
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if token != "secret_access" {
+		t.Errorf("incorrect token expected secret_access got: %s", token)
+	}
+
+	if len(responses) != 2 || responses[0] != http.StatusOK || responses[1] != http.StatusOK {
+		t.Errorf("incorrect callback responses expected [200 200] got: %v", responses)
+	}
+
+	expected := map[string]string{
+		"grant_type":   "authorization_code",
+		"code":         "granted",
+		"redirect_uri": "http://" + oauth.RedirectAddr + "/callback",
+	}
+	if len(tokens.requests) != 1 {
+		t.Fatalf("incorrect token requests expected 1 got: %d", len(tokens.requests))
+	}
+	for key, value := range expected {
+		if tokens.requests[0][key] != value {
+			t.Errorf("incorrect %s expected %s got: %s", key, value, tokens.requests[0][key])
+		}
+	}
+
+	cached := readCachedToken(t, cache)
+	if cached.AccessToken != "secret_access" || cached.RefreshToken != "refresh" || cached.WorkspaceName != "Team" {
+		t.Errorf("incorrect cached token got: %+v", cached)
+	}
+	if until := time.Until(cached.ExpiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("incorrect expiry expected in an hour got: %s", cached.ExpiresAt)
+	}
+
+	info, err := os.Stat(cache)
+	if err != nil {
+		t.Fatalf("expected nil got: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("incorrect cache permissions expected 0600 got: %o", info.Mode().Perm())
+	}
+
+	// The cached token is reused without going through the flow again
+	oauth.Prompt = func(string) { t.Errorf("expected the cached token to be used") }
+	if token, err = oauth.Token(); err != nil || token != "secret_access" {
+		t.Errorf("incorrect token expected secret_access got: %s %v", token, err)
+	}
+	if len(tokens.requests) != 1 {
+		t.Errorf("incorrect token requests expected 1 got: %d", len(tokens.requests))
+	}
+}
+
+func TestOAuth_AuthorizeDenied(t *testing.T) {
+	tokens := &tokenServer{}
+	newTokenServer(t, tokens)
+
+	tests := []struct {
+		name     string
+		callback func(state string) string
+		expected string
+	}{
+		{"denied", func(state string) string { return "error=access_denied&state=" + state }, "OAuth authorization failed: access_denied"},
+		{"invalid state", func(state string) string { return "code=granted&state=forged" }, "invalid state"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oauth := OAuth{
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RedirectAddr: freeAddr(t),
+				Prompt: func(authorizeURL string) {
+					u, _ := url.Parse(authorizeURL)
+					query := u.Query()
+					response, err := http.Get(query.Get("redirect_uri") + "?" + test.callback(query.Get("state")))
+					if err != nil {
+						t.Errorf("expected nil got: %v", err)
+						return
+					}
+					response.Body.Close()
+				},
+			}
+
+			_, err := oauth.Token()
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("incorrect error expected %q got: %v", test.expected, err)
+			}
+		})
+	}
+
+	if len(tokens.requests) != 0 {
+		t.Errorf("incorrect token requests expected none got: %d", len(tokens.requests))
+	}
+}
+
+func TestOAuth_Refresh(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     string
+		expected     string
+		refreshToken string
+	}{
+		{"refresh token rotated", `{"access_token":"secret_new","refresh_token":"refresh_new","expires_in":3600}`, "secret_new", "refresh_new"},
+		{"refresh token kept", `{"access_token":"secret_new","expires_in":3600}`, "secret_new", "refresh"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens := &tokenServer{response: test.response}
+			newTokenServer(t, tokens)
+
+			cache := filepath.Join(t.TempDir(), "token.json")
+			expired := oauthToken{AccessToken: "secret_old", RefreshToken: "refresh", ExpiresAt: time.Now().Add(-time.Hour)}
+			oauth := OAuth{ClientID: "client", ClientSecret: "secret", CachePath: cache}
+			if err := oauth.writeCache(expired); err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := oauth.Token()
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if token != test.expected {
+				t.Errorf("incorrect token expected %s got: %s", test.expected, token)
+			}
+
+			if len(tokens.requests) != 1 || tokens.requests[0]["grant_type"] != "refresh_token" || tokens.requests[0]["refresh_token"] != "refresh" {
+				t.Errorf("incorrect token requests got: %v", tokens.requests)
+			}
+
+			cached := readCachedToken(t, cache)
+			if cached.AccessToken != test.expected || cached.RefreshToken != test.refreshToken || cached.expired() {
+				t.Errorf("incorrect cached token got: %+v", cached)
+			}
+		})
+	}
+}
+
+func TestOAuth_RefreshFailure(t *testing.T) {
+	tokens := &tokenServer{status: http.StatusBadRequest}
+	newTokenServer(t, tokens)
+
+	cache := filepath.Join(t.TempDir(), "token.json")
+	oauth := OAuth{ClientID: "client", ClientSecret: "secret", CachePath: cache}
+	if err := oauth.writeCache(oauthToken{AccessToken: "secret_old", RefreshToken: "revoked", ExpiresAt: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a redirect address the new authorization can not start
+	if _, err := oauth.Token(); err == nil || !strings.Contains(err.Error(), "redirect address is required") {
+		t.Errorf("incorrect error expected a new authorization got: %v", err)
+	}
+
+	if _, err := oauth.exchange(map[string]string{"grant_type": "refresh_token", "refresh_token": "revoked"}); err == nil || !strings.Contains(err.Error(), "status: 400") {
+		t.Errorf("incorrect error expected status: 400 got: %v", err)
+	}
+
+	// The cache is left untouched
+	if cached := readCachedToken(t, cache); cached.AccessToken != "secret_old" {
+		t.Errorf("incorrect cached token expected secret_old got: %s", cached.AccessToken)
+	}
+}
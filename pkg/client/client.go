@@ -1,201 +1,112 @@
 package client
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
 
-	"github.com/GustavoCaso/notion_workflows/pkg/types"
+	"github.com/dstotijn/go-notion"
 )
 
-const notionAPIURL = "https://api.notion.com/v1"
-
-type NotionClient struct {
-	httpClient http.Client
+// NotionClient is the subset of the Notion API used by the workflows.
+// Commands depend on this interface rather than on a concrete client so they
+// can share middleware and test doubles.
+type NotionClient interface {
+	FindDatabaseByID(ctx context.Context, id string) (notion.Database, error)
+	QueryDatabase(ctx context.Context, id string, query *notion.DatabaseQuery) (notion.DatabaseQueryResponse, error)
+	FindPageByID(ctx context.Context, id string) (notion.Page, error)
+	CreatePage(ctx context.Context, params notion.CreatePageParams) (notion.Page, error)
+	UpdatePage(ctx context.Context, pageID string, params notion.UpdatePageParams) (notion.Page, error)
+	FindBlockByID(ctx context.Context, blockID string) (notion.Block, error)
+	FindBlockChildrenByID(ctx context.Context, blockID string, query *notion.PaginationQuery) (notion.BlockChildrenResponse, error)
+	Search(ctx context.Context, opts *notion.SearchOpts) (notion.SearchResponse, error)
 }
 
-func NewHTTPClient(token string) NotionClient {
-	httpClient := http.Client{
-		Transport: &transport{
-			underlyingTransport: http.DefaultTransport,
-			token:               token,
-		},
-	}
-
-	return NotionClient{
-		httpClient: httpClient,
-	}
-}
-
-func (c NotionClient) FindOrCreatePage(databaseId string, pageQuery, pageBody io.Reader) types.PageResponse {
-	fmt.Printf("Querying DB %s with Query %s\n", databaseId, pageQuery)
-	request, err := http.NewRequest("POST", fmt.Sprintf("%s/databases/%s/query", notionAPIURL, databaseId), pageQuery)
-
-	if err != nil {
-		panic(err)
-	}
-
-	response, err := c.httpClient.Do(request)
-	if err != nil {
-		panic(err)
-	}
-	defer response.Body.Close()
-
-	if response.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(response.Body)
-
-		requestBodyReader, _ := request.GetBody()
+// Middleware wraps the HTTP transport used to talk to the Notion API.
+type Middleware func(http.RoundTripper) http.RoundTripper
 
-		requestBody, _ := ioutil.ReadAll(requestBodyReader)
-		panic(fmt.Errorf("Failed to list pages. Error %s. QueryBody sent %s", body, requestBody))
+// NewClient returns a NotionClient authenticated with token. Middlewares are
+// applied in order, so the first one sees the request first.
+func NewClient(token string, middlewares ...Middleware) NotionClient {
+	var transport http.RoundTripper = http.DefaultTransport
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
 	}
 
-	body, _ := ioutil.ReadAll(response.Body)
-
-	var listPageResponse types.ListPageResponse
-	err = json.Unmarshal(body, &listPageResponse)
-
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Printf("Querying DB Resulst%s\n", listPageResponse)
-
-	resultsLength := len(listPageResponse.Results)
-
-	if resultsLength == 1 {
-		return listPageResponse.Results[0]
+	httpClient := &http.Client{
+		Transport: transport,
 	}
 
-	if resultsLength > 1 {
-		panic(fmt.Errorf("multiple pages returns from querying the database: %s", databaseId))
-	}
-
-	return c.CreatePage(pageBody)
+	return notion.NewClient(token, notion.WithHTTPClient(httpClient))
 }
 
-func (c NotionClient) FindPages(databaseId string, pageQuery io.Reader) []types.PageResponse {
-	fmt.Printf("Querying DB %s with Query %s\n", databaseId, pageQuery)
-	request, err := http.NewRequest("POST", fmt.Sprintf("%s/databases/%s/query", notionAPIURL, databaseId), pageQuery)
-
-	if err != nil {
-		panic(err)
-	}
-
-	response, err := c.httpClient.Do(request)
-	if err != nil {
-		panic(err)
+// FindPages returns every page in the database matching filter.
+func FindPages(ctx context.Context, c NotionClient, databaseID string, filter *notion.DatabaseQueryFilter) ([]notion.Page, error) {
+	query := &notion.DatabaseQuery{
+		Filter: filter,
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(response.Body)
+	result := []notion.Page{}
 
-		requestBodyReader, _ := request.GetBody()
+	for {
+		response, err := c.QueryDatabase(ctx, databaseID, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query database %s. error: %w", databaseID, err)
+		}
 
-		requestBody, _ := ioutil.ReadAll(requestBodyReader)
-		panic(fmt.Errorf("Failed to list pages. Error %s. QueryBody sent %s", body, requestBody))
-	}
-
-	body, _ := ioutil.ReadAll(response.Body)
+		result = append(result, response.Results...)
 
-	var listPageResponse types.ListPageResponse
-	err = json.Unmarshal(body, &listPageResponse)
+		if !response.HasMore || response.NextCursor == nil {
+			return result, nil
+		}
 
-	if err != nil {
-		panic(err)
+		query.StartCursor = *response.NextCursor
 	}
-
-	if len(listPageResponse.Results) > 0 {
-		return listPageResponse.Results
-	}
-	return []types.PageResponse{}
 }
 
-func (c NotionClient) UpdatePage(pageID string, pageBody io.Reader) types.PageResponse {
-	fmt.Printf("Updating Page %s with Body %s\n", pageID, pageBody)
-	request, err := http.NewRequest("PATCH", fmt.Sprintf("%s/pages/%s", notionAPIURL, pageID), pageBody)
-
+// FindOrCreatePage returns the single page in the database matching filter,
+// creating it from params when there is none.
+func FindOrCreatePage(ctx context.Context, c NotionClient, databaseID string, filter *notion.DatabaseQueryFilter, params notion.CreatePageParams) (notion.Page, error) {
+	pages, err := FindPages(ctx, c, databaseID, filter)
 	if err != nil {
-		panic(err)
+		return notion.Page{}, err
 	}
 
-	response, err := c.httpClient.Do(request)
-	if err != nil {
-		panic(err)
+	if len(pages) == 1 {
+		return pages[0], nil
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(response.Body)
-
-		requestBodyReader, _ := request.GetBody()
-
-		requestBody, _ := ioutil.ReadAll(requestBodyReader)
-		panic(fmt.Errorf("Failed to update page. Error %s. QueryBody sent %s", body, requestBody))
+	if len(pages) > 1 {
+		return notion.Page{}, fmt.Errorf("multiple pages returns from querying the database: %s", databaseID)
 	}
 
-	body, _ := ioutil.ReadAll(response.Body)
-
-	var pageResponse types.PageResponse
-	err = json.Unmarshal(body, &pageResponse)
-
+	page, err := c.CreatePage(ctx, params)
 	if err != nil {
-		panic(err)
+		return notion.Page{}, fmt.Errorf("failed to create page in database %s. error: %w", databaseID, err)
 	}
 
-	return pageResponse
+	return page, nil
 }
 
-func (c NotionClient) CreatePage(postBody io.Reader) types.PageResponse {
-	request, err := http.NewRequest("POST", fmt.Sprintf("%s/pages", notionAPIURL), postBody)
-
-	if err != nil {
-		panic(err)
-	}
-
-	response, err := c.httpClient.Do(request)
+// FindBlockChildren returns every child of the block, following the
+// pagination of the API which returns at most 100 blocks per request.
+func FindBlockChildren(ctx context.Context, c NotionClient, blockID string) ([]notion.Block, error) {
+	query := &notion.PaginationQuery{}
 
-	if err != nil {
-		panic(err)
-	}
-	defer response.Body.Close()
+	result := []notion.Block{}
 
-	if response.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(response.Body)
+	for {
+		response, err := c.FindBlockChildrenByID(ctx, blockID, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract children blocks for block ID %s. error: %w", blockID, err)
+		}
 
-		requestBodyReader, _ := request.GetBody()
+		result = append(result, response.Results...)
 
-		requestBody, _ := ioutil.ReadAll(requestBodyReader)
-		panic(fmt.Errorf("Failed to create page. Error %s. PostBody sent %s", body, requestBody))
-	}
+		if !response.HasMore || response.NextCursor == nil {
+			return result, nil
+		}
 
-	body, _ := ioutil.ReadAll(response.Body)
-
-	var pageResponse types.PageResponse
-	err = json.Unmarshal(body, &pageResponse)
-
-	if err != nil {
-		panic(err)
+		query.StartCursor = *response.NextCursor
 	}
-
-	return pageResponse
-}
-
-type transport struct {
-	token               string
-	underlyingTransport http.RoundTripper
-}
-
-func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Add("Authorization", t.authToken())
-	req.Header.Add("Notion-Version", "2021-08-16")
-	req.Header.Add("Content-Type", "application/json")
-	return t.underlyingTransport.RoundTrip(req)
-}
-
-func (t *transport) authToken() string {
-	return fmt.Sprintf("Bearer %s", t.token)
 }
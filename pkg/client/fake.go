@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/dstotijn/go-notion"
+)
+
+var _ NotionClient = &Fake{}
+
+// Fake is an in-memory NotionClient to be used as a test double.
+type Fake struct {
+	Databases     map[string]notion.Database
+	DatabasePages map[string][]notion.Page
+	Pages         map[string]notion.Page
+	Blocks        map[string][]notion.Block
+	// PageSize splits the children of blocks in pages of this size, like the
+	// API does with 100. Zero returns all of them at once.
+	PageSize int
+	// BlockChildrenRequests counts the calls to FindBlockChildrenByID.
+	BlockChildrenRequests int
+	// LastQuery is the query of the last call to QueryDatabase. Its filter is
+	// not applied, every page of the database is returned.
+	LastQuery *notion.DatabaseQuery
+
+	mu sync.Mutex
+}
+
+func (f *Fake) FindDatabaseByID(ctx context.Context, id string) (notion.Database, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	db, ok := f.Databases[id]
+	if !ok {
+		return notion.Database{}, fmt.Errorf("database %s not found", id)
+	}
+	return db, nil
+}
+
+func (f *Fake) QueryDatabase(ctx context.Context, id string, query *notion.DatabaseQuery) (notion.DatabaseQueryResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if query != nil {
+		last := *query
+		f.LastQuery = &last
+	}
+
+	return notion.DatabaseQueryResponse{
+		Results: append([]notion.Page{}, f.DatabasePages[id]...),
+	}, nil
+}
+
+func (f *Fake) FindPageByID(ctx context.Context, id string) (notion.Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	page, ok := f.Pages[id]
+	if !ok {
+		return notion.Page{}, fmt.Errorf("page %s not found", id)
+	}
+	return page, nil
+}
+
+func (f *Fake) CreatePage(ctx context.Context, params notion.CreatePageParams) (notion.Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Pages == nil {
+		f.Pages = map[string]notion.Page{}
+	}
+
+	page := notion.Page{
+		ID: fmt.Sprintf("fake-page-%d", len(f.Pages)+1),
+		Parent: notion.Parent{
+			Type: params.ParentType,
+		},
+	}
+
+	if params.DatabasePageProperties != nil {
+		page.Parent.DatabaseID = params.ParentID
+		page.Properties = *params.DatabasePageProperties
+		if f.DatabasePages == nil {
+			f.DatabasePages = map[string][]notion.Page{}
+		}
+		f.DatabasePages[params.ParentID] = append(f.DatabasePages[params.ParentID], page)
+	} else {
+		page.Parent.PageID = params.ParentID
+		page.Properties = notion.PageProperties{
+			Title: notion.PageTitle{Title: params.Title},
+		}
+	}
+
+	f.Pages[page.ID] = page
+	return page, nil
+}
+
+func (f *Fake) UpdatePage(ctx context.Context, pageID string, params notion.UpdatePageParams) (notion.Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	page, ok := f.Pages[pageID]
+	if !ok {
+		return notion.Page{}, fmt.Errorf("page %s not found", pageID)
+	}
+
+	if params.DatabasePageProperties != nil {
+		page.Properties = params.DatabasePageProperties
+	}
+	if params.Archived != nil {
+		page.Archived = *params.Archived
+	}
+
+	f.Pages[pageID] = page
+	return page, nil
+}
+
+func (f *Fake) FindBlockByID(ctx context.Context, blockID string) (notion.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, children := range f.Blocks {
+		for _, block := range children {
+			if block.ID() == blockID {
+				return block, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("block %s not found", blockID)
+}
+
+func (f *Fake) FindBlockChildrenByID(ctx context.Context, blockID string, query *notion.PaginationQuery) (notion.BlockChildrenResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.BlockChildrenRequests++
+
+	blocks := f.Blocks[blockID]
+	if f.PageSize == 0 {
+		return notion.BlockChildrenResponse{
+			Results: append([]notion.Block{}, blocks...),
+		}, nil
+	}
+
+	// The cursor is the index of the first block of the page
+	start := 0
+	if query != nil && query.StartCursor != "" {
+		var err error
+		if start, err = strconv.Atoi(query.StartCursor); err != nil {
+			return notion.BlockChildrenResponse{}, fmt.Errorf("invalid cursor %q", query.StartCursor)
+		}
+	}
+	if start > len(blocks) {
+		start = len(blocks)
+	}
+
+	end := start + f.PageSize
+	if end >= len(blocks) {
+		return notion.BlockChildrenResponse{
+			Results: append([]notion.Block{}, blocks[start:]...),
+		}, nil
+	}
+
+	next := strconv.Itoa(end)
+	return notion.BlockChildrenResponse{
+		Results:    append([]notion.Block{}, blocks[start:end]...),
+		HasMore:    true,
+		NextCursor: &next,
+	}, nil
+}
+
+func (f *Fake) Search(ctx context.Context, opts *notion.SearchOpts) (notion.SearchResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := notion.SearchResults{}
+	for _, db := range f.Databases {
+		results = append(results, db)
+	}
+	for _, page := range f.Pages {
+		results = append(results, page)
+	}
+
+	return notion.SearchResponse{
+		Results: results,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimit_SharedAcrossGoroutines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: RateLimit(50)(http.DefaultTransport)}
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := httpClient.Get(server.URL)
+			if err != nil {
+				t.Errorf("expected nil got: %v", err)
+				return
+			}
+			response.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	// The first request is sent right away, the other five wait 20ms each
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("incorrect duration expected at least 100ms got: %v", elapsed)
+	}
+}
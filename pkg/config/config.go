@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/auth"
+)
+
+// Config holds the named profiles, one per Notion workspace.
+type Config struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Profile bundles everything the commands need to work against a workspace.
+type Profile struct {
+	Token   TokenConfig   `json:"token"`
+	Monthly MonthlyConfig `json:"monthly"`
+	Migrate MigrateConfig `json:"migrate"`
+}
+
+// TokenConfig describes where to find the token of the workspace.
+type TokenConfig struct {
+	Env         []string     `json:"env,omitempty"`
+	File        string       `json:"file,omitempty"`
+	Credentials string       `json:"credentials,omitempty"`
+	Workspace   string       `json:"workspace,omitempty"`
+	OAuth       *OAuthConfig `json:"oauth,omitempty"`
+}
+
+// OAuthConfig configures the OAuth flow of a public integration. The client
+// secret is read from the ClientSecretEnv environment variable so it does not
+// need to be stored in the config file.
+type OAuthConfig struct {
+	ClientID        string `json:"client_id"`
+	ClientSecretEnv string `json:"client_secret_env"`
+	RedirectAddr    string `json:"redirect_addr,omitempty"`
+	Cache           string `json:"cache,omitempty"`
+}
+
+// MonthlyConfig holds the database IDs used by cmd/monthly.
+type MonthlyConfig struct {
+	HabitTrackerDatabaseID          string `json:"habit_tracker_database_id,omitempty"`
+	MonthTrackingDatabaseID         string `json:"month_tracking_database_id,omitempty"`
+	WeekTrackingDatabaseID          string `json:"week_tracking_database_id,omitempty"`
+	HabitTrackerConfigurationPageID string `json:"habit_tracker_configuration_page_id,omitempty"`
+}
+
+// MigrateConfig holds the defaults used by cmd/migrate.
+type MigrateConfig struct {
+	Vault      string `json:"vault,omitempty"`
+	DatabaseID string `json:"database_id,omitempty"`
+}
+
+// Source returns the token sources described by the profile.
+func (t TokenConfig) Source() auth.TokenSource {
+	chain := auth.Chain{
+		auth.Env(t.Env),
+		auth.File(t.File),
+	}
+
+	if t.Credentials != "" || t.Workspace != "" {
+		chain = append(chain, auth.Netrc{
+			Path:      t.Credentials,
+			Workspace: t.Workspace,
+		})
+	}
+
+	if t.OAuth != nil {
+		redirectAddr := t.OAuth.RedirectAddr
+		if redirectAddr == "" {
+			redirectAddr = auth.DefaultRedirectAddr
+		}
+
+		chain = append(chain, auth.OAuth{
+			ClientID:     t.OAuth.ClientID,
+			ClientSecret: os.Getenv(t.OAuth.ClientSecretEnv),
+			RedirectAddr: redirectAddr,
+			CachePath:    t.OAuth.Cache,
+		})
+	}
+
+	return chain
+}
+
+// Load reads the config file at path.
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s. error: %w", path, err)
+	}
+
+	var config Config
+	if err = json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s. error: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+// Profile returns the profile called name.
+func (c *Config) Profile(name string) (*Profile, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s not found", name)
+	}
+	return &profile, nil
+}
+
+// Flags holds the command line options to select a profile.
+type Flags struct {
+	Path    string
+	Profile string
+}
+
+// RegisterFlags defines the profile flags on fs. Both can be set through
+// environment variables so they can be used from the GitHub Actions workflow.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+
+	fs.StringVar(&f.Path, "config", envOrDefault("NOTION_WORKFLOWS_CONFIG", defaultPath()), "config file with the workspace profiles")
+	fs.StringVar(&f.Profile, "profile", os.Getenv("NOTION_WORKFLOWS_PROFILE"), "name of the profile to use from the config file")
+
+	return f
+}
+
+// Load returns the selected profile, or nil when no profile was selected.
+func (f *Flags) Load() (*Profile, error) {
+	if f.Profile == "" {
+		return nil, nil
+	}
+
+	config, err := Load(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Profile(f.Profile)
+}
+
+// TokenSource returns the token sources for the command. An explicit -token
+// flag always wins, then the profile sources, and then the remaining flags
+// and the environment variables.
+func TokenSource(profile *Profile, flags *auth.Flags, envVars ...string) auth.TokenSource {
+	source := flags.Source(envVars...)
+	if profile == nil {
+		return source
+	}
+
+	return auth.Chain{
+		auth.Static(flags.Token),
+		profile.Token.Source(),
+		source,
+	}
+}
+
+func envOrDefault(name, value string) string {
+	if env := os.Getenv(name); env != "" {
+		return env
+	}
+	return value
+}
+
+func defaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "notion_workflows", "config.json")
+}
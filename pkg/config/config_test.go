@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GustavoCaso/notion_workflows/pkg/auth"
+)
+
+const testConfig = `{
+  "profiles": {
+    "personal": {
+      "token": {"env": ["CONFIG_TEST_PERSONAL_TOKEN"]},
+      "monthly": {"habit_tracker_database_id": "habits"},
+      "migrate": {"vault": "~/vaults/personal", "database_id": "journal"}
+    },
+    "team": {
+      "token": {"file": "team_token"},
+      "migrate": {"vault": "~/vaults/team"}
+    }
+  }
+}`
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFlags_Load(t *testing.T) {
+	path := writeConfig(t, testConfig)
+
+	tests := []struct {
+		name     string
+		flags    Flags
+		expected *Profile
+		err      string
+	}{
+		{
+			"personal profile",
+			Flags{Path: path, Profile: "personal"},
+			&Profile{
+				Token:   TokenConfig{Env: []string{"CONFIG_TEST_PERSONAL_TOKEN"}},
+				Monthly: MonthlyConfig{HabitTrackerDatabaseID: "habits"},
+				Migrate: MigrateConfig{Vault: "~/vaults/personal", DatabaseID: "journal"},
+			},
+			"",
+		},
+		{
+			"team profile",
+			Flags{Path: path, Profile: "team"},
+			&Profile{
+				Token:   TokenConfig{File: "team_token"},
+				Migrate: MigrateConfig{Vault: "~/vaults/team"},
+			},
+			"",
+		},
+		{"no profile selected", Flags{Path: path}, nil, ""},
+		{"no profile selected without config file", Flags{Path: filepath.Join(t.TempDir(), "missing.json")}, nil, ""},
+		{"missing profile", Flags{Path: path, Profile: "work"}, nil, "profile work not found"},
+		{"missing config file", Flags{Path: filepath.Join(t.TempDir(), "missing.json"), Profile: "personal"}, nil, "failed to read config file"},
+		{"invalid config file", Flags{Path: writeConfig(t, `{"profiles": [`), Profile: "personal"}, nil, "failed to parse config file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile, err := test.flags.Load()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("incorrect error expected %q got: %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+
+			if test.expected == nil {
+				if profile != nil {
+					t.Errorf("incorrect profile expected nil got: %+v", profile)
+				}
+				return
+			}
+
+			if profile == nil {
+				t.Fatalf("incorrect profile expected %+v got: nil", test.expected)
+			}
+			if strings.Join(profile.Token.Env, ",") != strings.Join(test.expected.Token.Env, ",") || profile.Token.File != test.expected.Token.File {
+				t.Errorf("incorrect token config expected %+v got: %+v", test.expected.Token, profile.Token)
+			}
+			if profile.Monthly != test.expected.Monthly {
+				t.Errorf("incorrect monthly config expected %+v got: %+v", test.expected.Monthly, profile.Monthly)
+			}
+			if profile.Migrate != test.expected.Migrate {
+				t.Errorf("incorrect migrate config expected %+v got: %+v", test.expected.Migrate, profile.Migrate)
+			}
+		})
+	}
+}
+
+func TestRegisterFlags_Env(t *testing.T) {
+	t.Setenv("NOTION_WORKFLOWS_CONFIG", "from-env.json")
+	t.Setenv("NOTION_WORKFLOWS_PROFILE", "team")
+
+	tests := []struct {
+		name    string
+		args    []string
+		path    string
+		profile string
+	}{
+		{"environment", []string{}, "from-env.json", "team"},
+		{"flags before environment", []string{"-config", "from-flag.json", "-profile", "personal"}, "from-flag.json", "personal"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags := RegisterFlags(fs)
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if flags.Path != test.path || flags.Profile != test.profile {
+				t.Errorf("incorrect flags expected %s %s got: %s %s", test.path, test.profile, flags.Path, flags.Profile)
+			}
+		})
+	}
+}
+
+func TestTokenSource_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	teamToken := filepath.Join(dir, "team_token")
+	if err := os.WriteFile(teamToken, []byte("from-profile-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	personal := &Profile{Token: TokenConfig{Env: []string{"CONFIG_TEST_PERSONAL_TOKEN"}}}
+	team := &Profile{Token: TokenConfig{File: teamToken}}
+	unset := &Profile{Token: TokenConfig{Env: []string{"CONFIG_TEST_UNSET_TOKEN"}}}
+
+	// The credentials file is missing and there is no OAuth client, so only
+	// the token, the token file and the environment can be found
+	noCredentials := filepath.Join(dir, "netrc")
+
+	tests := []struct {
+		name     string
+		profile  *Profile
+		flags    auth.Flags
+		env      map[string]string
+		expected string
+	}{
+		{
+			"token flag before profile",
+			personal,
+			auth.Flags{Token: "from-flag", Credentials: noCredentials},
+			map[string]string{"CONFIG_TEST_PERSONAL_TOKEN": "from-profile", "CONFIG_TEST_NOTION_TOKEN": "from-env"},
+			"from-flag",
+		},
+		{
+			"profile env before command env",
+			personal,
+			auth.Flags{Credentials: noCredentials},
+			map[string]string{"CONFIG_TEST_PERSONAL_TOKEN": "from-profile", "CONFIG_TEST_NOTION_TOKEN": "from-env"},
+			"from-profile",
+		},
+		{
+			"profile file before command env",
+			team,
+			auth.Flags{Credentials: noCredentials},
+			map[string]string{"CONFIG_TEST_NOTION_TOKEN": "from-env"},
+			"from-profile-file",
+		},
+		{
+			"command env when the profile has no token",
+			unset,
+			auth.Flags{Credentials: noCredentials},
+			map[string]string{"CONFIG_TEST_NOTION_TOKEN": "from-env"},
+			"from-env",
+		},
+		{
+			"command env without profile",
+			nil,
+			auth.Flags{Credentials: noCredentials},
+			map[string]string{"CONFIG_TEST_PERSONAL_TOKEN": "from-profile", "CONFIG_TEST_NOTION_TOKEN": "from-env"},
+			"from-env",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"CONFIG_TEST_PERSONAL_TOKEN", "CONFIG_TEST_UNSET_TOKEN", "CONFIG_TEST_NOTION_TOKEN"} {
+				t.Setenv(name, test.env[name])
+			}
+
+			flags := test.flags
+			token, err := TokenSource(test.profile, &flags, "CONFIG_TEST_NOTION_TOKEN").Token()
+			if err != nil {
+				t.Fatalf("expected nil got: %v", err)
+			}
+			if token != test.expected {
+				t.Errorf("incorrect token expected '%s' got: %s", test.expected, token)
+			}
+		})
+	}
+
+	t.Setenv("CONFIG_TEST_UNSET_TOKEN", "")
+	t.Setenv("CONFIG_TEST_NOTION_TOKEN", "")
+	if _, err := TokenSource(unset, &auth.Flags{Credentials: noCredentials}, "CONFIG_TEST_NOTION_TOKEN").Token(); !errors.Is(err, auth.ErrNoToken) {
+		t.Errorf("expected ErrNoToken got: %v", err)
+	}
+}